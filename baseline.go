@@ -0,0 +1,68 @@
+package fehler
+
+// Identifies a diagnostic for baseline matching, ignoring its position.
+type baselineKey struct {
+	code    string
+	message string
+	file    string
+}
+
+// Identifies a diagnostic for baseline matching, including its position.
+type baselinePosKey struct {
+	baselineKey
+	line   int
+	column int
+}
+
+func newBaselineKey(d *Diagnostic) baselinePosKey {
+	var key baselinePosKey
+	key.message = d.ResolvedMessage()
+	if d.Code != nil {
+		key.code = *d.Code
+	}
+	if d.Range != nil {
+		key.file = d.Range.File
+		key.line = d.Range.Start.Line
+		key.column = d.Range.Start.Column
+	}
+	return key
+}
+
+// Returns the diagnostics in current that do not appear in baseline.
+// Diagnostics match when their code, message, and file are equal. Exact position
+// matches are paired up first; remaining baseline entries then absorb diagnostics
+// whose position merely shifted, e.g. because lines were added above them.
+// Each baseline entry matches at most one current diagnostic.
+func FilterAgainstBaseline(current []*Diagnostic, baseline []*Diagnostic) []*Diagnostic {
+	exact := make(map[baselinePosKey]int)
+	shifted := make(map[baselineKey]int)
+	for _, d := range baseline {
+		key := newBaselineKey(d)
+		exact[key]++
+		shifted[key.baselineKey]++
+	}
+
+	matched := make([]bool, len(current))
+	for i, d := range current {
+		key := newBaselineKey(d)
+		if exact[key] > 0 {
+			exact[key]--
+			shifted[key.baselineKey]--
+			matched[i] = true
+		}
+	}
+
+	var fresh []*Diagnostic
+	for i, d := range current {
+		if matched[i] {
+			continue
+		}
+		key := newBaselineKey(d).baselineKey
+		if shifted[key] > 0 {
+			shifted[key]--
+			continue
+		}
+		fresh = append(fresh, d)
+	}
+	return fresh
+}
@@ -0,0 +1,43 @@
+package fehler
+
+// Collects several diagnostics through a fluent interface.
+// Builders created with ErrorReporter.NewBatch report the diagnostics on Build.
+type DiagnosticBuilder struct {
+	diagnostics []*Diagnostic
+	reporter    *ErrorReporter
+}
+
+// Creates an empty builder that is not attached to a reporter.
+func NewDiagnosticBuilder() *DiagnosticBuilder {
+	return &DiagnosticBuilder{}
+}
+
+// Creates an empty builder whose Build reports the diagnostics with ReportMany.
+func (e *ErrorReporter) NewBatch() *DiagnosticBuilder {
+	return &DiagnosticBuilder{reporter: e}
+}
+
+// Adds a diagnostic to the batch.
+func (b *DiagnosticBuilder) Add(d *Diagnostic) *DiagnosticBuilder {
+	b.diagnostics = append(b.diagnostics, d)
+	return b
+}
+
+// Adds an error without a location to the batch.
+func (b *DiagnosticBuilder) AddError(msg string) *DiagnosticBuilder {
+	return b.Add(NewDiagnostic(SeverityError, msg))
+}
+
+// Adds a warning at the given location to the batch.
+func (b *DiagnosticBuilder) AddWarningAt(msg, file string, line, col int) *DiagnosticBuilder {
+	return b.Add(NewDiagnosticWithLocation(SeverityWarning, msg, file, line, col))
+}
+
+// Returns the diagnostics in the order they were added.
+// If the builder came from NewBatch, they are reported first.
+func (b *DiagnosticBuilder) Build() []*Diagnostic {
+	if b.reporter != nil {
+		b.reporter.ReportMany(b.diagnostics)
+	}
+	return b.diagnostics
+}
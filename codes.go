@@ -0,0 +1,70 @@
+package fehler
+
+import (
+	"slices"
+	"strings"
+)
+
+// Summary of one diagnostic code seen in a batch, for generating error indexes.
+type CodeInfo struct {
+	Code          string
+	Severity      Severity
+	Count         int
+	SampleMessage string
+}
+
+// Returns one entry per distinct code in ds, sorted by code.
+// Severity and SampleMessage come from the first diagnostic with that code.
+// Diagnostics without a code are ignored.
+func CollectCodes(ds []*Diagnostic) []CodeInfo {
+	index := make(map[string]int)
+	var infos []CodeInfo
+	for _, d := range ds {
+		if d.Code == nil {
+			continue
+		}
+		if i, ok := index[*d.Code]; ok {
+			infos[i].Count++
+			continue
+		}
+		index[*d.Code] = len(infos)
+		infos = append(infos, CodeInfo{
+			Code:          *d.Code,
+			Severity:      d.Severity,
+			Count:         1,
+			SampleMessage: d.ResolvedMessage(),
+		})
+	}
+
+	slices.SortFunc(infos, func(a, b CodeInfo) int {
+		return strings.Compare(a.Code, b.Code)
+	})
+	return infos
+}
+
+// Registers the default severity of a diagnostic code. Diagnostics with that
+// code and a different severity are annotated as "escalated" or "demoted" in
+// the Fehler header, e.g. "error[W001, escalated]".
+func (e *ErrorReporter) RegisterCode(code string, defaultSeverity Severity) {
+	if e.CodeSeverities == nil {
+		e.CodeSeverities = make(map[string]Severity)
+	}
+	e.CodeSeverities[code] = defaultSeverity
+}
+
+// Returns "escalated" or "demoted" if the diagnostic's severity is more or less
+// severe than the registered default for its code, or "" otherwise.
+func (e *ErrorReporter) severityChange(d *Diagnostic) string {
+	if d.Code == nil {
+		return ""
+	}
+	def, ok := e.CodeSeverities[*d.Code]
+	switch {
+	case !ok || d.Severity == def:
+		return ""
+	case d.Severity < def:
+		return "escalated"
+	default:
+		return "demoted"
+	}
+}
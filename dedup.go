@@ -0,0 +1,27 @@
+package fehler
+
+import "fmt"
+
+// Keys a diagnostic by severity, code, message, and the start of its range.
+func DedupKeyFull(d *Diagnostic) string {
+	code := ""
+	if d.Code != nil {
+		code = *d.Code
+	}
+	return fmt.Sprintf("%d\x00%s\x00%s\x00%s", d.Severity, code, d.ResolvedMessage(), DedupKeyLocation(d))
+}
+
+// Keys a diagnostic by the file, line, and column where its range starts.
+// Diagnostics without a range get the empty key, so they are never deduplicated.
+func DedupKeyLocation(d *Diagnostic) string {
+	if d.Range == nil {
+		return ""
+	}
+	r := d.Range.Normalize()
+	return fmt.Sprintf("%s:%d:%d", r.File, r.Start.Line, r.Start.Column)
+}
+
+// Keys a diagnostic by its resolved message only.
+func DedupKeyMessage(d *Diagnostic) string {
+	return d.ResolvedMessage()
+}
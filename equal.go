@@ -0,0 +1,62 @@
+package fehler
+
+// Returns true if both diagnostics have the same severity, resolved message, code,
+// help, URL, suppression, and primary range. Notes, secondary ranges, and other
+// attachments are not compared.
+func (d *Diagnostic) Equal(other *Diagnostic) bool {
+	return d.ApproxEquals(other, 0)
+}
+
+// Returns true if the diagnostics are Equal except that range columns may differ
+// by up to toleranceColumns. Lines and files must still match.
+// Intended for test helpers matching captured compiler output; do not use in production logic.
+func (d *Diagnostic) ApproxEquals(other *Diagnostic, toleranceColumns int) bool {
+	return d.sameContent(other) && rangesMatch(d.Range, other.Range, func(a, b Position) bool {
+		return a.Line == b.Line && abs(a.Column-b.Column) <= toleranceColumns
+	})
+}
+
+// Returns true if the diagnostics are Equal except for range columns, which are ignored.
+// Intended for test helpers matching captured compiler output; do not use in production logic.
+func (d *Diagnostic) ApproxEqualsLine(other *Diagnostic) bool {
+	return d.sameContent(other) && rangesMatch(d.Range, other.Range, func(a, b Position) bool {
+		return a.Line == b.Line
+	})
+}
+
+// Compares everything ApproxEquals looks at except the range.
+func (d *Diagnostic) sameContent(other *Diagnostic) bool {
+	if d == nil || other == nil {
+		return d == other
+	}
+	return d.Severity == other.Severity &&
+		d.ResolvedMessage() == other.ResolvedMessage() &&
+		stringPtrEqual(d.Code, other.Code) &&
+		stringPtrEqual(d.Help, other.Help) &&
+		stringPtrEqual(d.Url, other.Url) &&
+		d.Suppressed == other.Suppressed
+}
+
+// Returns true if both ranges are nil, or both are in the same file with
+// normalized start and end positions accepted by match.
+func rangesMatch(a, b *SourceRange, match func(a, b Position) bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	na, nb := a.Normalize(), b.Normalize()
+	return na.File == nb.File && match(na.Start, nb.Start) && match(na.End, nb.End)
+}
+
+func stringPtrEqual(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,42 @@
+package fehler
+
+import "fmt"
+
+// An error annotated with the source location it refers to.
+// Useful for attaching positions to errors from packages like strconv or bufio
+// that know nothing about the source being processed.
+type AnnotatedError struct {
+	Err  error
+	Loc  SourceRange
+	Hint string
+}
+
+// Wraps an error with the given source range.
+func Annotate(err error, r SourceRange) *AnnotatedError {
+	return &AnnotatedError{Err: err, Loc: r}
+}
+
+// Wraps an error with the given source range and a hint for fixing it.
+func AnnotateHint(err error, r SourceRange, hint string) *AnnotatedError {
+	return &AnnotatedError{Err: err, Loc: r, Hint: hint}
+}
+
+// Returns the wrapped error's message prefixed with its location.
+func (a *AnnotatedError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", a.Loc.File, a.Loc.Start.Line, a.Loc.Start.Column, a.Err.Error())
+}
+
+// Returns the wrapped error.
+func (a *AnnotatedError) Unwrap() error {
+	return a.Err
+}
+
+// Converts the error to an error-severity diagnostic located at Loc.
+// The hint, if any, becomes the diagnostic's help text.
+func (a *AnnotatedError) Diagnostic() *Diagnostic {
+	d := NewDiagnostic(SeverityError, a.Err.Error()).WithRange(a.Loc)
+	if a.Hint != "" {
+		d.WithHelp(a.Hint)
+	}
+	return d
+}
@@ -1,13 +1,25 @@
 package fehler
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 const (
 	colorReset   = "\x1b[0m"
 	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
 	colorYellow  = "\x1b[33m"
 	colorBlue    = "\x1b[34m"
 	colorMagenta = "\x1b[35m"
@@ -17,25 +29,163 @@ const (
 	colorDim     = "\x1b[2m"
 )
 
+// Whether new reporters start with color disabled.
+// Set at package init when the NO_COLOR environment variable is non-empty (see https://no-color.org).
+var noColorDefault bool
+
+func init() {
+	noColorDefault = os.Getenv("NO_COLOR") != ""
+}
+
+// Overrides the default NoColor value used by NewErrorReporter.
+// This is mainly useful in tests, since the environment is only consulted once at package init.
+func SetNoColorDefault(v bool) {
+	noColorDefault = v
+}
+
 type OutputFormat int
 
 const (
 	FormatFehler OutputFormat = iota
 	FormatGCC
 	FormatMSVC
+	// Prints only "severity[code]: message", without location or snippet,
+	// so identical diagnostics produce identical log lines across runs.
+	FormatMessageOnly
+)
+
+// Returned, wrapped, by FormatAs for formats it cannot render. Only the text
+// formats above are supported; use EmitSarif for SARIF output.
+var ErrUnsupportedFormat = errors.New("fehler: unsupported output format")
+
+func (f OutputFormat) isValid() bool {
+	return f >= FormatFehler && f <= FormatMessageOnly
+}
+
+// Selects the icons shown before severity labels when UseIcons is set.
+type IconStyle int
+
+const (
+	// Single-width Unicode symbols, as returned by Severity.Icon: "✗", "⚠", "ℹ", "✓".
+	IconStyleSymbol IconStyle = iota
+	// Emoji such as "❌", "⚠️", and "💡", most of which are two columns wide.
+	IconStyleEmoji
+	// ASCII markers such as "[x]" and "[!]", for terminals without Unicode.
+	IconStyleASCII
+)
+
+// An icon and the number of terminal columns it occupies.
+type icon struct {
+	text  string
+	width int
+}
+
+// Icons per severity for IconStyleEmoji and IconStyleASCII.
+var (
+	emojiIcons = map[Severity]icon{
+		SeverityFatal:         {"💥", 2},
+		SeverityError:         {"❌", 2},
+		SeverityWarning:       {"⚠️", 2},
+		SeverityNote:          {"💡", 2},
+		SeverityTodo:          {"📝", 2},
+		SeverityUnimplemented: {"🚧", 2},
+		SeveritySuccess:       {"✅", 2},
+	}
+	asciiIcons = map[Severity]icon{
+		SeverityFatal:         {"[x]", 3},
+		SeverityError:         {"[x]", 3},
+		SeverityWarning:       {"[!]", 3},
+		SeverityNote:          {"[i]", 3},
+		SeverityTodo:          {"[~]", 3},
+		SeverityUnimplemented: {"[~]", 3},
+		SeveritySuccess:       {"[+]", 3},
+	}
+)
+
+// Returns the icon for sev in this style.
+func (s IconStyle) icon(sev Severity) icon {
+	switch s {
+	case IconStyleEmoji:
+		return emojiIcons[sev]
+	case IconStyleASCII:
+		return asciiIcons[sev]
+	default:
+		text := sev.Icon()
+		return icon{text, utf8.RuneCountInString(text)}
+	}
+}
+
+// Selects the default gutter separator between line numbers and source text.
+type GutterStyle int
+
+const (
+	GutterStyleASCII GutterStyle = iota
+	GutterStyleUnicode
+)
+
+// Controls where notes, help, and documentation lines are printed in the Fehler format.
+type HelpPosition int
+
+const (
+	HelpAfter HelpPosition = iota
+	HelpBefore
 )
 
 // Represents a position in source code with line and column information.
+// Lines and columns are 1-based, as shown to users; columns count runes.
+// Use LineIndex, ColumnIndex, or ZeroBase for 0-based indexes into slices.
 type Position struct {
 	Line   int
 	Column int
 }
 
+// Returns the position as "line:column".
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Returns true if this position comes before other, comparing line then column.
+func (p Position) Before(other Position) bool {
+	if p.Line != other.Line {
+		return p.Line < other.Line
+	}
+	return p.Column < other.Column
+}
+
+// Returns the 0-based index of the line, e.g. for lines[p.LineIndex()].
+// Lines before the first are clamped to 0.
+func (p Position) LineIndex() int {
+	return max(p.Line-1, 0)
+}
+
+// Returns the 0-based index of the column, e.g. for []rune(line)[p.ColumnIndex()].
+// Columns before the first are clamped to 0.
+func (p Position) ColumnIndex() int {
+	return max(p.Column-1, 0)
+}
+
+// Returns a copy of this position with a 0-based line and column, clamped to 0
+// like LineIndex and ColumnIndex.
+func (p Position) ZeroBase() Position {
+	return Position{Line: p.LineIndex(), Column: p.ColumnIndex()}
+}
+
+// Returns true if this position comes after other, comparing line then column.
+func (p Position) After(other Position) bool {
+	return other.Before(p)
+}
+
+// Returns true if this position is at the same line and column as other.
+func (p Position) Equal(other Position) bool {
+	return p == other
+}
+
 // Represents a range in source code with start and end positions.
 type SourceRange struct {
 	File  string
 	Start Position
 	End   Position
+	Label string
 }
 
 // Creates a single-character range at the specified position.
@@ -56,6 +206,157 @@ func NewSourceRangeSpan(file string, startLine int, startColumn int, endLine int
 	}
 }
 
+// Creates a single-line range covering length runes starting at the given column.
+// A length of 0 or less yields a single-character range.
+func NewSourceRangeLen(file string, line, column, length int) SourceRange {
+	if length <= 0 {
+		return NewSourceRangeSingle(file, line, column)
+	}
+	return NewSourceRangeSpan(file, line, column, line, column+length-1)
+}
+
+// Creates a range covering all of lineContent, the text of the given line, from
+// column 1 to its last rune. An empty line yields a single-character range at column 1.
+func NewSourceRangeLine(file string, line int, lineContent string) SourceRange {
+	return NewSourceRangeLen(file, line, 1, utf8.RuneCountInString(lineContent))
+}
+
+// Creates a single-line range from a regexp match on text, the content of the given line.
+// m is a byte offset pair as returned by regexp.FindStringIndex; it is converted
+// to rune columns, with the end column on the last rune of the match. An empty
+// match yields a single-character range at its position. Returns the zero
+// SourceRange, which is not IsValid, if m is nil or out of bounds.
+func NewSourceRangeFromMatch(file string, line int, text string, m []int) SourceRange {
+	if len(m) < 2 || m[0] < 0 || m[0] > m[1] || m[1] > len(text) {
+		return SourceRange{}
+	}
+	start := utf8.RuneCountInString(text[:m[0]]) + 1
+	length := utf8.RuneCountInString(text[m[0]:m[1]])
+	return NewSourceRangeLen(file, line, start, length)
+}
+
+// Returns the range as "file:line:col-line:col", or "file:line:col" for a single character.
+func (s SourceRange) String() string {
+	if s.IsSingleChar() {
+		return fmt.Sprintf("%s:%s", s.File, s.Start)
+	}
+	return fmt.Sprintf("%s:%s-%s", s.File, s.Start, s.End)
+}
+
+// Returns the range in the compact form "file:startLine:startCol-endLine:endCol",
+// e.g. as a cache key. ParseSourceRange reverses it. The label is not included.
+func (s SourceRange) Encode() string {
+	return fmt.Sprintf("%s:%d:%d-%d:%d", s.File, s.Start.Line, s.Start.Column, s.End.Line, s.End.Column)
+}
+
+// Parses a range in the form written by Encode. The numbers are taken from the
+// end, so the file name may itself contain colons, as in "C:\src\main.go:1:2-1:5".
+func ParseSourceRange(s string) (SourceRange, error) {
+	rest, endColumn, ok1 := cutLast(s, ":")
+	rest, span, ok2 := cutLast(rest, ":")
+	file, startLine, ok3 := cutLast(rest, ":")
+	startColumn, endLine, ok4 := strings.Cut(span, "-")
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return SourceRange{}, fmt.Errorf("fehler: malformed source range %q", s)
+	}
+
+	var nums [4]int
+	for i, field := range []string{startLine, startColumn, endLine, endColumn} {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return SourceRange{}, fmt.Errorf("fehler: malformed source range %q: %w", s, err)
+		}
+		nums[i] = n
+	}
+	return NewSourceRangeSpan(file, nums[0], nums[1], nums[2], nums[3]), nil
+}
+
+// Slices s around the last instance of sep, like strings.Cut from the end.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// Returns the start of the range as "file:line:col", as used by GCC-style output.
+// A nil range or one without a file is shown as "<unknown>".
+func (s *SourceRange) ToGCCString() string {
+	if s == nil {
+		return "<unknown>:0:0"
+	}
+	n := s.Normalize()
+	return fmt.Sprintf("%s:%d:%d", n.displayFile(), n.Start.Line, n.Start.Column)
+}
+
+// Returns the start of the range as "file(line, col)", as used by MSVC-style output.
+// A nil range or one without a file is shown as "<unknown>".
+func (s *SourceRange) ToMSVCString() string {
+	if s == nil {
+		return "<unknown>(0, 0)"
+	}
+	n := s.Normalize()
+	return fmt.Sprintf("%s(%d, %d)", n.displayFile(), n.Start.Line, n.Start.Column)
+}
+
+func (s SourceRange) displayFile() string {
+	if s.File == "" {
+		return "<unknown>"
+	}
+	return s.File
+}
+
+// Returns a copy of this range with an inline label.
+// The label is printed next to the underline when the range is rendered.
+func (s SourceRange) WithLabel(label string) SourceRange {
+	s.Label = label
+	return s
+}
+
+// Returns a copy of this range with Start and End swapped if End comes before Start.
+// Useful for ranges built from reverse selections.
+func (s SourceRange) Normalize() SourceRange {
+	if s.End.Before(s.Start) {
+		s.Start, s.End = s.End, s.Start
+	}
+	return s
+}
+
+// Returns a copy of this range fixed up for display: a zero End is set to Start,
+// Start and End are swapped if End comes before Start, and both are clamped to
+// line 1 and column 1. This is a defensive normalization, not a validity check.
+func (s SourceRange) Canonicalize() SourceRange {
+	if s.End == (Position{}) {
+		s.End = s.Start
+	}
+	s = s.Normalize()
+	s.Start = Position{Line: max(s.Start.Line, 1), Column: max(s.Start.Column, 1)}
+	s.End = Position{Line: max(s.End.Line, 1), Column: max(s.End.Column, 1)}
+	return s
+}
+
+// Returns true if the range has a file and 1-based start and end positions.
+// The zero SourceRange is not valid.
+func (s SourceRange) IsValid() bool {
+	return s.File != "" && s.HasPosition() && s.End.Line > 0 && s.End.Column > 0
+}
+
+// Returns false if the line or column is 0, meaning only the file is known.
+func (s SourceRange) HasPosition() bool {
+	return s.Start.Line > 0 && s.Start.Column > 0
+}
+
+// Returns true if other starts at the column right after this range ends, in the same file.
+// Adjacency never crosses a line break: a range ending at the last character of a line
+// is not adjacent to one starting at column 1 of the next line, because ranges do not
+// know line lengths. This holds for multiline ranges too, which are adjacent only when
+// other starts on the line where this range ends.
+func (s SourceRange) IsAdjacentTo(other SourceRange) bool {
+	return s.File == other.File &&
+		s.End.Line == other.Start.Line &&
+		s.End.Column+1 == other.Start.Column
+}
+
 // Returns true if this range spans multiple lines.
 func (s SourceRange) IsMultiline() bool {
 	return s.Start.Line != s.End.Line
@@ -77,6 +378,58 @@ func (s SourceRange) Length() int {
 	return 1
 }
 
+// Returns true if other lies entirely within this range, in the same file.
+// Every range contains itself, so a single-character or empty range contains
+// only a range with the same start and end.
+func (s SourceRange) ContainsRange(other SourceRange) bool {
+	return s.File == other.File &&
+		(s.Start.Before(other.Start) || s.Start.Equal(other.Start)) &&
+		(s.End.After(other.End) || s.End.Equal(other.End))
+}
+
+// Returns true if this range and o share any position in the same file.
+// Both ends are inclusive, so ranges meeting at one column intersect, while
+// adjacent ranges (see IsAdjacentTo) do not. Inverted ranges are normalized first.
+func (s SourceRange) Intersects(o SourceRange) bool {
+	s, o = s.Normalize(), o.Normalize()
+	return s.File == o.File && !s.End.Before(o.Start) && !o.End.Before(s.Start)
+}
+
+// Returns the byte offset of a position in source.
+// Columns count runes, and a column one past the end of the line is allowed.
+// Returns false if the position does not exist in source.
+func offsetOf(source string, p Position) (int, bool) {
+	if p.Line < 1 || p.Column < 1 {
+		return 0, false
+	}
+
+	offset := 0
+	for line := 1; line < p.Line; line++ {
+		i := strings.IndexByte(source[offset:], '\n')
+		if i < 0 {
+			return 0, false
+		}
+		offset += i + 1
+	}
+
+	text := source[offset:]
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+
+	column := 1
+	for i := range text {
+		if column == p.Column {
+			return offset + i, true
+		}
+		column++
+	}
+	if column == p.Column {
+		return offset + len(text), true
+	}
+	return 0, false
+}
+
 // Severity levels for diagnostics, determining color and label presentation.
 type Severity int
 
@@ -87,6 +440,8 @@ const (
 	SeverityNote
 	SeverityTodo
 	SeverityUnimplemented
+	// Reports an affirmative result, such as a check that found no issues.
+	SeveritySuccess
 )
 
 // Returns the ANSI color code associated with this severity level.
@@ -102,6 +457,8 @@ func (s Severity) Color() string {
 		return colorMagenta
 	case SeverityUnimplemented:
 		return colorCyan
+	case SeveritySuccess:
+		return colorGreen
 	default:
 		return ""
 	}
@@ -122,11 +479,36 @@ func (s Severity) Label() string {
 		return "todo"
 	case SeverityUnimplemented:
 		return "unimplemented"
+	case SeveritySuccess:
+		return "ok"
 	default:
 		return "unknown"
 	}
 }
 
+// Returns a Unicode icon for this severity level, shown before the label when
+// UseIcons is set.
+func (s Severity) Icon() string {
+	switch s {
+	case SeverityFatal, SeverityError:
+		return "✗"
+	case SeverityWarning:
+		return "⚠"
+	case SeverityNote:
+		return "ℹ"
+	case SeverityTodo, SeverityUnimplemented, SeveritySuccess:
+		return "✓"
+	default:
+		return ""
+	}
+}
+
+// A location related to a diagnostic, rendered after its primary range.
+type Related struct {
+	Range   SourceRange
+	Message string
+}
+
 // A diagnostic message with optional source range and help text.
 // This is the primary data structure for representing compiler errors, warnings, and notes.
 type Diagnostic struct {
@@ -136,6 +518,40 @@ type Diagnostic struct {
 	Help     *string
 	Code     *string
 	Url      *string
+
+	// Suppressed diagnostics are acknowledged by the user and skipped when reported.
+	Suppressed bool
+
+	// Additional locations related to the diagnostic, rendered after the primary Range.
+	SecondaryRanges []SourceRange
+
+	// Notes attached to the diagnostic, each optionally with its own range.
+	Notes []*Diagnostic
+
+	Suggestions []Suggestion
+
+	// Locale to render the message in, e.g. "fr". Empty means the message as written (English).
+	MessageLocale string
+
+	// Source text for the primary range's file, used for snippets when that file
+	// is not registered with the reporter, e.g. for REPL input.
+	InlineSource string
+
+	// Other locations involved in the diagnostic, each with an optional message.
+	Related []Related
+
+	// Extra single-line highlights on the primary range's line, underlined
+	// together with the primary range under one message.
+	Spots []SourceRange
+
+	// Execution path leading to the diagnostic, in order, exported as a SARIF code flow.
+	CodeFlow []SourceRange
+
+	// What was being done when the diagnostic arose, e.g. "while compiling function 'foo'",
+	// printed as a "context:" line above the header.
+	ContextMessage *string
+
+	messageArgs []any
 }
 
 // Creates a new diagnostic with the specified severity and message.
@@ -154,6 +570,12 @@ func (d *Diagnostic) WithRange(r SourceRange) *Diagnostic {
 	return d
 }
 
+// Returns a copy of this diagnostic with the specified source range, labeled
+// inline beneath its underline, like WithRange(r.WithLabel(label)).
+func (d *Diagnostic) WithLabeledRange(r SourceRange, label string) *Diagnostic {
+	return d.WithRange(r.WithLabel(label))
+}
+
 // Returns a copy of this diagnostic with a single-character range.
 // This method follows the builder pattern for fluent construction of diagnostics.
 func (d *Diagnostic) WithLocation(file string, line int, column int) *Diagnostic {
@@ -169,245 +591,2515 @@ func (d *Diagnostic) WithHelp(help string) *Diagnostic {
 	return d
 }
 
-// Returns a copy of this diagnostic with the specified error code.
-// The code can be used to look up error documentation.
-func (d *Diagnostic) WithCode(code string) *Diagnostic {
-	d.Code = &code
+// Returns a copy of this diagnostic with a context line printed above its header.
+func (d *Diagnostic) WithContextMessage(msg string) *Diagnostic {
+	d.ContextMessage = &msg
 	return d
 }
 
-// Returns a copy of this diagnostic with the specified documentation URL.
-// Useful for linking to online resources about this error.
-func (d *Diagnostic) WithUrl(url string) *Diagnostic {
-	d.Url = &url
+// Returns a copy of this diagnostic whose message is formatted lazily.
+// Message is treated as a fmt.Sprintf format string and the args are only
+// substituted when the diagnostic is rendered (see ResolvedMessage).
+func (d *Diagnostic) WithArgs(args ...any) *Diagnostic {
+	d.messageArgs = args
 	return d
 }
 
-// A comprehensive error reporting system that manages source files and formats diagnostics.
-// This reporter can store multiple source files and display rich error messages with
-// source code context, similar to modern compiler error output.
-type ErrorReporter struct {
-	Sources map[string]string
-	Format  OutputFormat
-}
-
-// Initializes a new ErrorReporter with the given allocator.
-// The reporter starts with no source files registered.
-// Uses the default output format (Fehler).
-func NewErrorReporter() *ErrorReporter {
-	return &ErrorReporter{
-		Sources: make(map[string]string),
-		Format:  FormatFehler,
+// Returns the message with any arguments from WithArgs substituted.
+func (d *Diagnostic) ResolvedMessage() string {
+	if len(d.messageArgs) == 0 {
+		return d.Message
 	}
+	return fmt.Sprintf(d.Message, d.messageArgs...)
 }
 
-// Returns a copy of this reporter with the specified output format.
-func (e *ErrorReporter) WithFormat(format OutputFormat) *ErrorReporter {
-	e.Format = format
-	return e
+// Returns a copy of this diagnostic whose message is translated into locale when rendered.
+func (d *Diagnostic) WithMessageLocale(locale string) *Diagnostic {
+	d.MessageLocale = locale
+	return d
 }
 
-// Adds a source file to the reporter for later reference in diagnostics.
-// The content is duplicated and owned by the reporter.
-func (e *ErrorReporter) AddSource(filename string, content string) {
-	e.Sources[filename] = content
+// Returns a copy of this diagnostic with an additional, secondary range.
+func (d *Diagnostic) WithSecondaryRange(r SourceRange) *Diagnostic {
+	d.SecondaryRanges = append(d.SecondaryRanges, r)
+	return d
 }
 
-// Reports a single diagnostic to stdout with color formatting.
-// If the diagnostic has a range and the source file is available,
-// displays a source code snippet with the error range highlighted.
-func (e *ErrorReporter) Report(diagnostic *Diagnostic) {
-	switch e.Format {
-	case FormatFehler:
-		e.printFehler(diagnostic)
-	case FormatGCC:
-		e.printGcc(diagnostic)
-	case FormatMSVC:
-		e.printMsvc(diagnostic)
+// Returns a copy of this diagnostic with r as its primary range, which drives
+// the location header and the severity-colored underline.
+// A previous primary range is kept as a secondary range, and r is removed
+// from the secondary ranges if it was one of them.
+func (d *Diagnostic) WithPrimary(r SourceRange) *Diagnostic {
+	d.SecondaryRanges = slices.DeleteFunc(d.SecondaryRanges, func(sr SourceRange) bool {
+		return sr == r
+	})
+	if d.Range != nil && *d.Range != r {
+		d.SecondaryRanges = append([]SourceRange{*d.Range}, d.SecondaryRanges...)
 	}
+	d.Range = &r
+	return d
 }
 
-// Reports multiple diagnostics in sequence.
-// Each diagnostic is printed with the same formatting as `report()`.
-func (e *ErrorReporter) ReportMany(diagnostics []*Diagnostic) {
-	for _, diagnostic := range diagnostics {
-		e.Report(diagnostic)
-	}
+// Returns a copy of this diagnostic with a note attached.
+func (d *Diagnostic) WithNote(msg string) *Diagnostic {
+	d.Notes = append(d.Notes, NewDiagnostic(SeverityNote, msg))
+	return d
 }
 
-func (e *ErrorReporter) printFehler(diagnostic *Diagnostic) {
-	if diagnostic.Code != nil {
-		fmt.Printf("%s%s%s[%s]%s: %s\n",
-			diagnostic.Severity.Color(),
-			colorBold,
-			diagnostic.Severity.Label(),
-			*diagnostic.Code,
-			colorReset,
-			diagnostic.Message,
-		)
-	} else {
-		fmt.Printf("%s%s%s%s: %s\n",
-			diagnostic.Severity.Color(),
-			colorBold,
-			diagnostic.Severity.Label(),
-			colorReset,
-			diagnostic.Message,
-		)
+// Returns a copy of this diagnostic with several notes attached in order.
+func (d *Diagnostic) WithNotes(msgs ...string) *Diagnostic {
+	for _, msg := range msgs {
+		d.WithNote(msg)
 	}
+	return d
+}
 
-	if diagnostic.Range != nil {
-		r := *diagnostic.Range
-		fmt.Printf("  %s%s%s:%d:%d%s\n",
-			colorCyan,
-			colorBold,
-			r.File,
-			r.Start.Line,
-			r.Start.Column,
-			colorReset,
-		)
-
-		color := diagnostic.Severity.Color()
-		e.printSourceSnippet(r, color)
-	}
+// Returns a copy of this diagnostic with a note pointing at a single character.
+func (d *Diagnostic) WithNoteAt(msg, file string, line, col int) *Diagnostic {
+	d.Notes = append(d.Notes, NewDiagnosticWithLocation(SeverityNote, msg, file, line, col))
+	return d
+}
 
-	if diagnostic.Help != nil {
-		fmt.Printf("  %s%shelp%s: %s\n", colorCyan, colorBold, colorReset, *diagnostic.Help)
-	}
+// Returns a copy of this diagnostic with a suggested replacement for the text covered by r.
+func (d *Diagnostic) WithSuggestion(r SourceRange, replacement string) *Diagnostic {
+	d.Suggestions = append(d.Suggestions, Suggestion{Range: r, Replacement: replacement})
+	return d
+}
 
-	if diagnostic.Url != nil {
-		fmt.Printf("  %s%ssee%s: %s\n", colorCyan, colorBold, colorReset, *diagnostic.Url)
-	}
+// Returns a copy of this diagnostic marked as suppressed.
+func (d *Diagnostic) Suppress() *Diagnostic {
+	d.Suppressed = true
+	return d
+}
 
-	fmt.Println()
+// Returns a copy of this diagnostic carrying the source of its primary range's
+// file, so that snippets render without AddSource.
+func (d *Diagnostic) WithInlineSource(content string) *Diagnostic {
+	d.InlineSource = content
+	return d
 }
 
-func (e *ErrorReporter) printGcc(diagnostic *Diagnostic) {
-	color := diagnostic.Severity.Color()
-	if diagnostic.Range != nil {
-		r := *diagnostic.Range
-		fmt.Printf("%s%s:%d:%d: %s%s: %s%s%s%s\n",
-			colorBold,
-			r.File,
-			r.Start.Line,
-			r.Start.Column,
-			color,
-			diagnostic.Severity.Label(),
-			colorReset,
-			colorBold,
-			diagnostic.Message,
-			colorReset,
-		)
-	} else {
-		fmt.Printf("%s%s%s: %s%s%s%s\n",
-			colorBold,
-			color,
-			diagnostic.Severity.Label(),
-			colorReset,
-			colorBold,
-			diagnostic.Message,
-			colorReset,
-		)
-	}
+// Returns a copy of this diagnostic with a related location and message.
+func (d *Diagnostic) WithRelated(r SourceRange, msg string) *Diagnostic {
+	d.Related = append(d.Related, Related{Range: r, Message: msg})
+	return d
 }
 
-func (e *ErrorReporter) printMsvc(diagnostic *Diagnostic) {
-	if diagnostic.Range != nil {
-		code := "unknown"
-		if diagnostic.Code != nil {
-			code = *diagnostic.Code
-		}
-		r := *diagnostic.Range
-		fmt.Printf("%s(%d, %d): %s %s: %s\n",
-			r.File,
-			r.Start.Line,
-			r.Start.Column,
-			diagnostic.Severity.Label(),
-			code,
-			diagnostic.Message,
-		)
-	} else {
-		fmt.Printf("%s: %s\n",
-			diagnostic.Severity.Label(),
-			diagnostic.Message,
-		)
-	}
+// Returns a copy of this diagnostic with a related location that has no message.
+// Only its snippet is rendered.
+func (d *Diagnostic) WithRelatedRange(r SourceRange) *Diagnostic {
+	return d.WithRelated(r, "")
 }
 
-// Prints a source code snippet showing the context around a diagnostic range.
-// Shows 2 lines before and after the error location, with the error range highlighted
-// using carets (^) for single characters or tildes (~) for ranges.
-func (e *ErrorReporter) printSourceSnippet(r SourceRange, color string) {
-	source, ok := e.Sources[r.File]
-	if !ok {
-		return
+// Returns a copy of this diagnostic with every range moved to file: the primary
+// range, secondary ranges, spots, related ranges, suggestions, note ranges, and
+// code flow steps.
+// Diagnostics without a primary range are left unchanged.
+func (d *Diagnostic) WithFile(file string) *Diagnostic {
+	if d.Range == nil {
+		return d
 	}
-
-	lines := strings.Split(source, "\n")
-	contextStart := 1
-	if r.Start.Line > 2 {
-		contextStart = r.Start.Line - 2
+	d.Range.File = file
+	for i := range d.SecondaryRanges {
+		d.SecondaryRanges[i].File = file
 	}
-
-	contextEnd := r.Start.Line + 2
-	if r.IsMultiline() {
-		contextEnd = r.End.Line + 2
+	for i := range d.Spots {
+		d.Spots[i].File = file
 	}
-	if contextEnd > len(lines) {
-		contextEnd = len(lines)
+	for i := range d.Related {
+		d.Related[i].Range.File = file
 	}
-
-	for currentLine := contextStart; currentLine <= contextEnd; currentLine++ {
-		line := lines[currentLine-1]
-		lineNumWidth := 4
-		isErrorLine := currentLine >= r.Start.Line && currentLine <= r.End.Line
-
-		if isErrorLine {
-			fmt.Printf("  %s%s%4d |%s %s\n",
-				colorRed,
-				colorBold,
-				currentLine,
-				colorReset,
-				line,
-			)
-
-			e.printUnderline(r, currentLine, lineNumWidth, color)
-		} else {
-			fmt.Printf("  %s%4d |%s %s\n",
-				colorDim,
-				currentLine,
-				colorReset,
-				line,
-			)
+	for i := range d.Suggestions {
+		d.Suggestions[i].Range.File = file
+	}
+	for _, note := range d.Notes {
+		if note.Range != nil {
+			note.Range.File = file
 		}
 	}
+	for i := range d.CodeFlow {
+		d.CodeFlow[i].File = file
+	}
+	return d
 }
 
-// Prints the underline (carets or tildes) for a specific line in a range.
-func (e *ErrorReporter) printUnderline(r SourceRange, lineNum int, lineNumWidth int, color string) {
-	fmt.Print("  ", color)
-	fmt.Print(strings.Repeat(" ", lineNumWidth+1))
-	fmt.Print("  ")
+// Returns a copy of this diagnostic with the given spots highlighted alongside the primary range.
+// Use ValidateSpots to check that they lie on the primary range's line.
+func (d *Diagnostic) WithSpots(spots ...SourceRange) *Diagnostic {
+	d.Spots = append(d.Spots, spots...)
+	return d
+}
 
-	if r.IsMultiline() {
-		if lineNum == r.Start.Line {
-			fmt.Print(strings.Repeat(" ", r.Start.Column-1))
-			fmt.Print("~")
-			fmt.Print(strings.Repeat("~", 80-(r.Start.Column)))
-		} else if lineNum == r.End.Line {
-			fmt.Print(strings.Repeat("~", r.End.Column))
-		} else if lineNum > r.Start.Line && lineNum < r.End.Line {
-			fmt.Print(strings.Repeat("~", 80))
-		}
-	} else {
-		fmt.Print(strings.Repeat(" ", r.Start.Column-1))
-		if r.IsSingleChar() {
-			fmt.Print("^")
-		} else {
-			fmt.Print(strings.Repeat("~", r.Length()))
+// Returns an error if the diagnostic has spots but no single-line primary range,
+// or if any spot is not on the same file and line as the primary range.
+func (d *Diagnostic) ValidateSpots() error {
+	if len(d.Spots) == 0 {
+		return nil
+	}
+	if d.Range == nil || d.Range.IsMultiline() {
+		return fmt.Errorf("fehler: spots require a single-line primary range")
+	}
+	for _, spot := range d.Spots {
+		if spot.File != d.Range.File || spot.Start.Line != d.Range.Start.Line || spot.IsMultiline() {
+			return fmt.Errorf("fehler: spot %s is not on the primary line %s:%d", spot, d.Range.File, d.Range.Start.Line)
 		}
 	}
+	return nil
+}
+
+// Returns a copy of this diagnostic with the given execution path as its code flow.
+func (d *Diagnostic) WithCodeFlow(steps []SourceRange) *Diagnostic {
+	d.CodeFlow = slices.Clone(steps)
+	return d
+}
+
+// Returns a copy of this diagnostic with the specified error code.
+// The code can be used to look up error documentation.
+func (d *Diagnostic) WithCode(code string) *Diagnostic {
+	d.Code = &code
+	return d
+}
 
-	fmt.Println(colorReset)
+// Returns a copy of this diagnostic with the specified documentation URL.
+// Useful for linking to online resources about this error.
+func (d *Diagnostic) WithUrl(url string) *Diagnostic {
+	d.Url = &url
+	return d
+}
+
+// A comprehensive error reporting system that manages source files and formats diagnostics.
+// This reporter can store multiple source files and display rich error messages with
+// source code context, similar to modern compiler error output.
+type ErrorReporter struct {
+	Sources map[string]string
+	Format  OutputFormat
+	NoColor bool
+	Writer  io.Writer
+
+	// Maximum width of a rendered row, used to keep inline labels from wrapping.
+	TermWidth int
+
+	// Stops ReportMany and WriteTo after the first fatal diagnostic has been reported.
+	StopOnFatal bool
+
+	// Severities that are never reported or counted, independent of any other filtering.
+	DisabledSeverities map[Severity]bool
+
+	// Least severe level that is reported; less severe diagnostics, such as notes
+	// when this is SeverityWarning, are hidden and not counted. Nil reports all.
+	MinSeverity *Severity
+
+	// Ends each ReportMany call that hid diagnostics below MinSeverity with a line
+	// such as "2 warnings hidden (raise verbosity to show)".
+	ShowHiddenCount bool
+
+	// Prints "..." above and below a snippet when lines of the file are cut off.
+	ShowEllipsis bool
+
+	// Renders suppressed diagnostics dimmed instead of skipping them.
+	ShowSuppressed bool
+
+	// Source language per file, as registered with AddSourceWithLanguage.
+	Languages map[string]string
+
+	// Bolds keywords in snippets of sources with a supported language (currently "go").
+	SyntaxHighlighting bool
+
+	// Wraps snippet lines longer than this many runes onto continuation rows.
+	// Zero disables wrapping.
+	WrapWidth int
+
+	// Prints an interim summary line after every SummaryEvery reported diagnostics.
+	// Zero disables interim summaries.
+	SummaryEvery int
+
+	// Prepended to every line the reporter writes, e.g. to nest output under a test name.
+	IndentPrefix string
+
+	// Shows line numbers in locations and gutters starting at 0, to match
+	// 0-based editors. Ranges are always 1-based; only the displayed numbers
+	// are shifted.
+	ZeroBasedLines bool
+
+	// Right-aligns severity labels in Fehler headers to the width of the longest
+	// label, so that messages without a code start at the same column.
+	AlignLabels bool
+
+	// Truncates snippet lines longer than this many runes, ending them with
+	// TruncationIndicator. Underlines are clipped to the same width; one that
+	// lies entirely past the cut becomes a caret under the indicator.
+	// Zero shows lines in full.
+	MaxLineWidth int
+
+	// Marks the end of a truncated snippet line.
+	TruncationIndicator string
+
+	// Follows the indicator of a truncated line with a dimmed "[+N chars]"
+	// count of the runes that were cut off.
+	ShowTruncationColumn bool
+
+	// Expands tabs in snippets to this many columns per tab stop, moving
+	// underlines to match. Zero prints tabs as they are.
+	TabWidth int
+
+	// Skips reporting diagnostics whose key was already reported. An empty key
+	// is never treated as a duplicate. Nil reports every diagnostic. See DedupKeyFull, DedupKeyLocation, and DedupKeyMessage.
+	DedupKey func(*Diagnostic) string
+
+	// Called once, with the first fatal or error diagnostic reported, e.g. to
+	// fail a CI job early. Suppressed and filtered diagnostics do not trigger it.
+	OnFirstError func(*Diagnostic)
+
+	// Called with every fatal or error diagnostic reported, e.g. to ring the bell
+	// in watch mode (see RingBell). Suppressed and filtered diagnostics do not trigger it.
+	OnError func(*Diagnostic)
+
+	// Translates the messages of diagnostics that have a MessageLocale, given the
+	// locale and the untranslated Message as key. Returns "" when it has no
+	// translation. Nil disables translation.
+	MessageCatalog func(locale, key string) string
+
+	// Skips diagnostics whose range file the function rejects. Diagnostics
+	// without a range are always reported. Nil reports every file.
+	FileFilter func(file string) bool
+
+	// Shows the end of multi-character ranges in location lines, as "file:10:5-20"
+	// or "file:10:5 - 12:3", instead of only the start.
+	ShowRangeInLocation bool
+
+	// Prefixes severity labels in Fehler headers with an icon, e.g. "✗ error".
+	UseIcons bool
+
+	// Selects the icons shown when UseIcons is set.
+	IconStyle IconStyle
+
+	// Prints the help and documentation lines of a code only for its first diagnostic
+	// in a ReportMany call. Later ones show "help: (see above)" instead.
+	DedupeHelp bool
+
+	// Default severity per diagnostic code, as registered with RegisterCode.
+	// Headers note when a diagnostic was escalated or demoted from its default.
+	CodeSeverities map[string]Severity
+
+	// Supplies snippet lines startLine through endLine (1-based, inclusive) of
+	// file instead of Sources, e.g. from a database or virtual file system. It is
+	// called even for registered files; only source carried by the diagnostic
+	// itself (see WithInlineSource) is used instead. It may return fewer lines
+	// at the end of the file.
+	ContextLineProvider func(file string, startLine, endLine int) ([]string, error)
+
+	// Replaces runs of three or more identical lines in a snippet with a
+	// "⋮ (N identical lines)" marker. The first and last line of the range
+	// are always shown.
+	CollapseRepeats bool
+
+	// Template for the "see" line of diagnostics that have a Code but no Url,
+	// e.g. "https://errors.example.com/{code}". Empty disables synthesized links.
+	DocURLTemplate string
+
+	// Collapses a diagnostic's notes, and separately its secondary ranges, beyond
+	// the first MaxGroupSize into a "... N more" line. Zero shows all of them.
+	MaxGroupSize int
+
+	// Folds multiline ranges spanning more than this many lines, showing only
+	// their first and last lines around a "... N lines omitted ..." marker.
+	// Zero shows every line.
+	MaxSnippetLines int
+
+	// Prepended to the message of every reported diagnostic, e.g. a tool name.
+	// The diagnostics themselves are not modified.
+	MessagePrefix string
+
+	// ANSI code for carets and tildes under source lines, e.g. "\x1b[36m".
+	// Empty uses the severity color, like the header label.
+	UnderlineColor string
+
+	// Separates line numbers from source text in snippets.
+	GutterChar string
+
+	// Prints notes, help, and documentation lines before or after the snippet.
+	HelpPosition HelpPosition
+
+	// Previews each suggestion of a diagnostic as a dimmed copy of the source
+	// line with the replacement applied, printed between the line and its underline.
+	ShowGhostText bool
+
+	// Previews each suggestion as a diff hunk below the snippet, with the affected
+	// lines prefixed by "-" in red and the rewritten lines by "+" in green.
+	ShowSuggestionDiff bool
+
+	// Appends "(offset N)" to location lines, where N is the byte offset of the
+	// range start in its registered source.
+	ShowOffset bool
+
+	abortFn func(code int)
+
+	// Additional format and writer pairs registered with AddFormat.
+	extraOutputs []formatOutput
+
+	// How often the progress goroutine started by WithProgressOutput prints.
+	ProgressInterval time.Duration
+
+	// Serializes writes of reported diagnostics with progress lines.
+	writeMu      sync.Mutex
+	progressStop chan struct{}
+	progressDone chan struct{}
+
+	// Source hashes restored by ImportState.
+	sourceHashes map[string]string
+
+	mu         sync.Mutex
+	counts     map[Severity]int
+	suppressed int
+	collected  []*Diagnostic
+	seenKeys   map[string]bool
+	sawError   bool
+}
+
+// Initializes a new ErrorReporter with the given allocator.
+// The reporter starts with no source files registered.
+// Uses the default output format (Fehler).
+// Color is disabled by default when the NO_COLOR environment variable is set.
+func NewErrorReporter() *ErrorReporter {
+	return &ErrorReporter{
+		Sources:             make(map[string]string),
+		Format:              FormatFehler,
+		NoColor:             noColorDefault,
+		Writer:              os.Stdout,
+		TermWidth:           defaultTermWidth,
+		ShowEllipsis:        true,
+		GutterChar:          "|",
+		MaxGroupSize:        defaultMaxGroupSize,
+		TruncationIndicator: "…",
+		ShowHiddenCount:     true,
+		abortFn:             os.Exit,
+	}
+}
+
+// Returns a copy of this reporter with the specified output format.
+func (e *ErrorReporter) WithFormat(format OutputFormat) *ErrorReporter {
+	e.Format = format
+	return e
+}
+
+// Sets the output format of an existing reporter, e.g. once command-line flags
+// are parsed. Unlike WithFormat it is not meant for chaining.
+func (e *ErrorReporter) SetFormat(format OutputFormat) {
+	e.Format = format
+}
+
+// Returns a copy of this reporter with ANSI colors disabled or enabled.
+func (e *ErrorReporter) WithNoColor(noColor bool) *ErrorReporter {
+	e.NoColor = noColor
+	return e
+}
+
+// Returns a copy of this reporter that writes its output to w instead of stdout.
+func (e *ErrorReporter) WithWriter(w io.Writer) *ErrorReporter {
+	e.Writer = w
+	return e
+}
+
+// Returns a copy of this reporter with the specified terminal width.
+func (e *ErrorReporter) WithTermWidth(width int) *ErrorReporter {
+	e.TermWidth = width
+	return e
+}
+
+// Returns a copy of this reporter that stops reporting after the first fatal diagnostic.
+func (e *ErrorReporter) WithStopOnFatal(stop bool) *ErrorReporter {
+	e.StopOnFatal = stop
+	return e
+}
+
+// Returns a copy of this reporter that skips diagnostics of the given severities.
+func (e *ErrorReporter) WithDisabledSeverities(severities ...Severity) *ErrorReporter {
+	if e.DisabledSeverities == nil {
+		e.DisabledSeverities = make(map[Severity]bool)
+	}
+	for _, sev := range severities {
+		e.DisabledSeverities[sev] = true
+	}
+	return e
+}
+
+// Returns a copy of this reporter that hides diagnostics less severe than sev.
+func (e *ErrorReporter) WithMinSeverity(sev Severity) *ErrorReporter {
+	e.MinSeverity = &sev
+	return e
+}
+
+// Returns a copy of this reporter that prints "[progress: N diagnostics so far]"
+// to its writer every interval from a background goroutine, until StopProgress
+// is called. Any goroutine started earlier is stopped first.
+func (e *ErrorReporter) WithProgressOutput(interval time.Duration) *ErrorReporter {
+	e.StopProgress()
+	e.ProgressInterval = interval
+	if interval <= 0 {
+		return e
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	e.progressStop, e.progressDone = stop, done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				e.printProgress()
+			}
+		}
+	}()
+	return e
+}
+
+// Stops the progress goroutine started by WithProgressOutput and waits for it
+// to exit. Does nothing if none is running.
+func (e *ErrorReporter) StopProgress() {
+	if e.progressStop == nil {
+		return
+	}
+	close(e.progressStop)
+	<-e.progressDone
+	e.progressStop, e.progressDone = nil, nil
+}
+
+func (e *ErrorReporter) printProgress() {
+	total := 0
+	for _, n := range e.CountBySeverity() {
+		total += n
+	}
+
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+	fmt.Fprintf(e.output(), "[progress: %d diagnostics so far]\n", total)
+}
+
+// Returns a copy of this reporter with the count of hidden diagnostics shown or not.
+func (e *ErrorReporter) WithShowHiddenCount(show bool) *ErrorReporter {
+	e.ShowHiddenCount = show
+	return e
+}
+
+// Returns a copy of this reporter with omitted-line markers in snippets enabled or disabled.
+func (e *ErrorReporter) WithShowEllipsis(show bool) *ErrorReporter {
+	e.ShowEllipsis = show
+	return e
+}
+
+// Returns a copy of this reporter that renders suppressed diagnostics dimmed
+// with a "(suppressed)" suffix instead of skipping them.
+func (e *ErrorReporter) WithShowSuppressed() *ErrorReporter {
+	e.ShowSuppressed = true
+	return e
+}
+
+// Returns a copy of this reporter that wraps snippet lines longer than width runes.
+func (e *ErrorReporter) WithWrapWidth(width int) *ErrorReporter {
+	e.WrapWidth = width
+	return e
+}
+
+// Returns a copy of this reporter that prints an interim summary after every n reported diagnostics.
+func (e *ErrorReporter) WithSummaryAfterN(n int) *ErrorReporter {
+	e.SummaryEvery = n
+	return e
+}
+
+// Returns a copy of this reporter that prefixes every output line with prefix.
+func (e *ErrorReporter) WithIndentPrefix(prefix string) *ErrorReporter {
+	e.IndentPrefix = prefix
+	return e
+}
+
+// Returns a copy of this reporter that displays line numbers starting at 0 instead of 1.
+func (e *ErrorReporter) WithZeroBasedLines(zeroBased bool) *ErrorReporter {
+	e.ZeroBasedLines = zeroBased
+	return e
+}
+
+// Returns a copy of this reporter with severity labels right-aligned or not.
+func (e *ErrorReporter) WithAlignLabels(align bool) *ErrorReporter {
+	e.AlignLabels = align
+	return e
+}
+
+// Returns a copy of this reporter that truncates snippet lines longer than width runes.
+func (e *ErrorReporter) WithMaxLineWidth(width int) *ErrorReporter {
+	e.MaxLineWidth = width
+	return e
+}
+
+// Returns a copy of this reporter that expands tabs in snippets to the given width.
+func (e *ErrorReporter) WithTabWidth(width int) *ErrorReporter {
+	e.TabWidth = width
+	return e
+}
+
+// Returns a copy of this reporter that skips diagnostics with an already reported key.
+func (e *ErrorReporter) WithDedupKey(fn func(*Diagnostic) string) *ErrorReporter {
+	e.DedupKey = fn
+	return e
+}
+
+// Returns a copy of this reporter that calls fn with the first error reported.
+func (e *ErrorReporter) WithOnFirstError(fn func(*Diagnostic)) *ErrorReporter {
+	e.OnFirstError = fn
+	return e
+}
+
+// Returns a copy of this reporter that also prints every reported diagnostic to w
+// in the given format. The reporter's own Writer and Format remain the first output.
+// Only Report, ReportMany, and ReportManyWithResult write to the added outputs.
+func (e *ErrorReporter) AddFormat(format OutputFormat, w io.Writer) *ErrorReporter {
+	e.extraOutputs = append(e.extraOutputs, formatOutput{format: format, w: w})
+	return e
+}
+
+// Returns a copy of this reporter that prints help for each code once per batch.
+func (e *ErrorReporter) WithDedupeHelp(dedupe bool) *ErrorReporter {
+	e.DedupeHelp = dedupe
+	return e
+}
+
+// Returns a copy of this reporter that shows whole ranges in location lines.
+func (e *ErrorReporter) WithRangeInLocation() *ErrorReporter {
+	e.ShowRangeInLocation = true
+	return e
+}
+
+// Returns a copy of this reporter with severity icons in Fehler headers.
+func (e *ErrorReporter) WithIcons() *ErrorReporter {
+	e.UseIcons = true
+	return e
+}
+
+// Returns a copy of this reporter with severity icons of the given style in Fehler headers.
+func (e *ErrorReporter) WithIconStyle(style IconStyle) *ErrorReporter {
+	e.UseIcons = true
+	e.IconStyle = style
+	return e
+}
+
+// Returns a copy of this reporter that translates messages with catalog.
+func (e *ErrorReporter) WithMessageCatalog(catalog func(locale, key string) string) *ErrorReporter {
+	e.MessageCatalog = catalog
+	return e
+}
+
+// Returns a copy of this reporter that calls fn with every error reported.
+func (e *ErrorReporter) WithOnError(fn func(*Diagnostic)) *ErrorReporter {
+	e.OnError = fn
+	return e
+}
+
+// Returns an OnError hook that writes the terminal bell character to w.
+func RingBell(w io.Writer) func(*Diagnostic) {
+	return func(*Diagnostic) {
+		io.WriteString(w, "\a")
+	}
+}
+
+// Returns a copy of this reporter that only reports diagnostics in files accepted by fn.
+func (e *ErrorReporter) WithFileFilter(fn func(string) bool) *ErrorReporter {
+	e.FileFilter = fn
+	return e
+}
+
+// Returns a file filter accepting files whose name starts with prefix.
+func FileFilterPrefix(prefix string) func(string) bool {
+	return func(file string) bool {
+		return strings.HasPrefix(file, prefix)
+	}
+}
+
+// Returns a copy of this reporter that reads snippet lines from fn instead of Sources.
+func (e *ErrorReporter) WithContextLineProvider(fn func(file string, startLine, endLine int) ([]string, error)) *ErrorReporter {
+	e.ContextLineProvider = fn
+	return e
+}
+
+// Returns a copy of this reporter with runs of identical snippet lines collapsed or not.
+func (e *ErrorReporter) WithCollapseRepeats(collapse bool) *ErrorReporter {
+	e.CollapseRepeats = collapse
+	return e
+}
+
+// Returns a copy of this reporter that links codes without a Url to template,
+// with "{code}" replaced by the diagnostic's code.
+func (e *ErrorReporter) WithDocURLTemplate(template string) *ErrorReporter {
+	e.DocURLTemplate = template
+	return e
+}
+
+// Returns a copy of this reporter that collapses notes and secondary ranges beyond the first n.
+func (e *ErrorReporter) WithMaxGroupSize(n int) *ErrorReporter {
+	e.MaxGroupSize = n
+	return e
+}
+
+// Returns a copy of this reporter that folds ranges spanning more than n lines.
+func (e *ErrorReporter) WithMaxSnippetLines(n int) *ErrorReporter {
+	e.MaxSnippetLines = n
+	return e
+}
+
+// Returns a copy of this reporter that prepends prefix to every diagnostic message.
+func (e *ErrorReporter) WithMessagePrefix(prefix string) *ErrorReporter {
+	e.MessagePrefix = prefix
+	return e
+}
+
+// Returns a copy of this reporter with underlines drawn in the given ANSI color.
+func (e *ErrorReporter) WithUnderlineColor(color string) *ErrorReporter {
+	e.UnderlineColor = color
+	return e
+}
+
+// Returns a copy of this reporter using the separator of the given gutter style:
+// "|" for GutterStyleASCII and "│" for GutterStyleUnicode.
+func (e *ErrorReporter) WithGutterStyle(style GutterStyle) *ErrorReporter {
+	if style == GutterStyleUnicode {
+		e.GutterChar = "│"
+	} else {
+		e.GutterChar = "|"
+	}
+	return e
+}
+
+// Returns a copy of this reporter with the given gutter separator.
+func (e *ErrorReporter) WithGutterChar(ch string) *ErrorReporter {
+	e.GutterChar = ch
+	return e
+}
+
+// Returns a copy of this reporter with notes and help printed at the given position.
+func (e *ErrorReporter) WithHelpPosition(pos HelpPosition) *ErrorReporter {
+	e.HelpPosition = pos
+	return e
+}
+
+// Returns a copy of this reporter with suggestions previewed as ghost text in snippets.
+func (e *ErrorReporter) WithGhostText() *ErrorReporter {
+	e.ShowGhostText = true
+	return e
+}
+
+// Returns a copy of this reporter with suggestions previewed as diff hunks.
+func (e *ErrorReporter) WithSuggestionDiff() *ErrorReporter {
+	e.ShowSuggestionDiff = true
+	return e
+}
+
+// Returns a copy of this reporter with byte offsets shown in location lines.
+func (e *ErrorReporter) WithShowOffset(show bool) *ErrorReporter {
+	e.ShowOffset = show
+	return e
+}
+
+// Adds a source file to the reporter for later reference in diagnostics.
+// The content is duplicated and owned by the reporter.
+func (e *ErrorReporter) AddSource(filename string, content string) {
+	e.Sources[filename] = content
+}
+
+// Adds every file in sources, keyed by file name, as if by AddSource.
+func (e *ErrorReporter) AddSources(sources map[string]string) {
+	for filename, content := range sources {
+		e.AddSource(filename, content)
+	}
+}
+
+// Walks dir and adds every regular file whose extension is one of exts, such as
+// ".go", under its path joined with dir. With no exts, every file is added.
+// Returns the first error walking the directory or reading a file.
+func (e *ErrorReporter) AddSourcesFromDir(dir string, exts ...string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if len(exts) > 0 && !slices.Contains(exts, filepath.Ext(path)) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		e.AddSource(path, string(content))
+		return nil
+	})
+}
+
+// Creates a range covering the whole of a line in a registered source, like NewSourceRangeLine.
+// A trailing carriage return is not part of the line. Returns an error if the
+// file is not registered or has no such line.
+func (e *ErrorReporter) NewSourceRangeForLine(file string, line int) (SourceRange, error) {
+	text, err := e.sourceLine(file, line)
+	if err != nil {
+		return SourceRange{}, err
+	}
+	return NewSourceRangeLine(file, line, text), nil
+}
+
+// Creates a single-character range just past the last character of a line in a
+// registered source, where its newline is, e.g. for an unexpected end of line.
+// An empty line yields column 1. Returns an error if the file is not registered
+// or has no such line.
+func (e *ErrorReporter) EndOfLineRange(file string, line int) (SourceRange, error) {
+	text, err := e.sourceLine(file, line)
+	if err != nil {
+		return SourceRange{}, err
+	}
+	return NewSourceRangeSingle(file, line, utf8.RuneCountInString(text)+1), nil
+}
+
+// Returns the text of a line in a registered source, without its line ending.
+func (e *ErrorReporter) sourceLine(file string, line int) (string, error) {
+	source, ok := e.Sources[file]
+	if !ok {
+		return "", fmt.Errorf("fehler: no source registered for %q", file)
+	}
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return "", fmt.Errorf("fehler: line %d is outside %q", line, file)
+	}
+	return strings.TrimSuffix(lines[line-1], "\r"), nil
+}
+
+// Returns true if a source with the given file name is registered.
+func (e *ErrorReporter) HasSource(filename string) bool {
+	_, ok := e.Sources[filename]
+	return ok
+}
+
+// Adds a source identified by a URI, such as one opened by a language server client.
+// Ranges whose file is this URI render its snippet like any other source.
+func (e *ErrorReporter) AddSourceURI(uri, content string) {
+	e.AddSource(uri, content)
+}
+
+// Adds a source file along with its language, which enables keyword
+// highlighting in snippets when SyntaxHighlighting is set.
+func (e *ErrorReporter) AddSourceWithLanguage(filename, content, language string) {
+	e.AddSource(filename, content)
+	if e.Languages == nil {
+		e.Languages = make(map[string]string)
+	}
+	e.Languages[filename] = language
+}
+
+// Returns a copy of this reporter with keyword highlighting in snippets enabled or disabled.
+func (e *ErrorReporter) WithSyntaxHighlighting(enabled bool) *ErrorReporter {
+	e.SyntaxHighlighting = enabled
+	return e
+}
+
+// Reports a single diagnostic to the reporter's writer (stdout by default) with color formatting.
+// If the diagnostic has a range and the source file is available,
+// displays a source code snippet with the error range highlighted.
+func (e *ErrorReporter) Report(diagnostic *Diagnostic) {
+	e.report(e.outputRenderer(), diagnostic, nil)
+}
+
+// Reports multiple diagnostics in sequence.
+// Each diagnostic is printed with the same formatting as `report()`.
+// Use ReportManyWithResult to learn whether reporting stopped early because of StopOnFatal.
+func (e *ErrorReporter) ReportMany(diagnostics []*Diagnostic) {
+	e.ReportManyWithResult(diagnostics)
+}
+
+// Summary of a single ReportManyWithResult call.
+type ReportManyResult struct {
+	// Number of diagnostics that were printed.
+	Printed int
+	// Number of suppressed diagnostics passed in, whether or not they were shown.
+	Suppressed int
+	// Number of reported, non-suppressed diagnostics for each severity.
+	Counts map[Severity]int
+	// Number of diagnostics hidden by MinSeverity for each severity.
+	Hidden map[Severity]int
+	// Whether any fatal or error diagnostic was reported.
+	HadErrors bool
+	// Whether reporting stopped early at a fatal diagnostic because StopOnFatal is set.
+	Stopped bool
+}
+
+// Reports multiple diagnostics like ReportMany and returns a summary of what happened
+// in this call. Diagnostics filtered out by DisabledSeverities, MinSeverity, or DedupKey, or left
+// unreported after StopOnFatal, are not counted.
+func (e *ErrorReporter) ReportManyWithResult(diagnostics []*Diagnostic) ReportManyResult {
+	result := ReportManyResult{Counts: make(map[Severity]int), Hidden: make(map[Severity]int)}
+	r := e.outputRenderer()
+	for _, diagnostic := range diagnostics {
+		if e.report(r, diagnostic, &result) && e.stopsAfter(diagnostic) {
+			result.Stopped = true
+			break
+		}
+	}
+	if e.ShowHiddenCount {
+		e.writeMu.Lock()
+		r.printHidden(result.Hidden)
+		e.writeMu.Unlock()
+	}
+	result.HadErrors = result.Counts[SeverityFatal]+result.Counts[SeverityError] > 0
+	return result
+}
+
+// Reports the diagnostics to w using the reporter's format, like ReportMany.
+// Unlike Report, write errors are not swallowed: it returns the number of bytes
+// written and the first write error encountered, after which nothing more is written.
+func (e *ErrorReporter) WriteTo(w io.Writer, ds []*Diagnostic) (int64, error) {
+	cw := &countingWriter{w: w}
+	e.reportAll(e.newRenderer(cw, e.Format), cw, ds)
+	return cw.n, cw.err
+}
+
+// Reports the diagnostics to the file at path, creating or truncating it, like WriteTo.
+// Colors are always disabled since the output is not a terminal.
+// Returns the first write or close error.
+func (e *ErrorReporter) ReportToFile(path string, ds []*Diagnostic) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	cw := &countingWriter{w: f}
+	r := e.newRenderer(cw, e.Format)
+	r.noColor = true
+	e.reportAll(r, cw, ds)
+
+	if err := f.Close(); cw.err == nil {
+		return err
+	}
+	return cw.err
+}
+
+// Reports ds through r until a write to cw fails or a fatal diagnostic stops reporting.
+func (e *ErrorReporter) reportAll(r *renderer, cw *countingWriter, ds []*Diagnostic) {
+	for _, d := range ds {
+		if cw.err != nil {
+			break
+		}
+		if e.report(r, d, nil) && e.stopsAfter(d) {
+			break
+		}
+	}
+}
+
+// Reports a diagnostic through the given renderer, tallying it into result if non-nil.
+// Returns false if the diagnostic was filtered out.
+func (e *ErrorReporter) report(r *renderer, diagnostic *Diagnostic, result *ReportManyResult) bool {
+	a := e.admit(diagnostic, result)
+	if !a.print {
+		return false
+	}
+	e.writeMu.Lock()
+
+	r.renderTee(diagnostic)
+	if result != nil {
+		result.Printed++
+	}
+
+	if a.counted {
+		e.printSummary(r, a.total)
+	}
+	e.writeMu.Unlock()
+
+	e.notify(diagnostic, a)
+	return true
+}
+
+// Prints the running summary if SummaryEvery is set and total is a multiple of it.
+// Only diagnostics that add to the reported counts may trigger it.
+func (e *ErrorReporter) printSummary(r *renderer, total int) {
+	if e.SummaryEvery <= 0 || total%e.SummaryEvery != 0 {
+		return
+	}
+	counts := e.CountBySeverity()
+	fmt.Fprintf(r.w, "[%d diagnostics so far: %d errors, %d warnings]\n",
+		total,
+		counts[SeverityFatal]+counts[SeverityError],
+		counts[SeverityWarning],
+	)
+}
+
+// Renders a diagnostic through r and every renderer it tees to.
+func (r *renderer) renderTee(d *Diagnostic) {
+	r.render(d)
+	for _, extra := range r.tee {
+		extra.render(d)
+	}
+}
+
+// Calls the OnFirstError and OnError hooks for a diagnostic once it has been
+// rendered, so that a hook which exits still leaves the diagnostic printed.
+func (e *ErrorReporter) notify(d *Diagnostic, a admission) {
+	if a.firstError && e.OnFirstError != nil {
+		e.OnFirstError(d)
+	}
+	if a.counted && d.Severity <= SeverityError && e.OnError != nil {
+		e.OnError(d)
+	}
+}
+
+// Prints how many diagnostics of each severity were hidden, if any, e.g.
+// "2 warnings, 1 note hidden (raise verbosity to show)".
+func (r *renderer) printHidden(hidden map[Severity]int) {
+	var parts []string
+	for sev := SeverityFatal; sev <= SeveritySuccess; sev++ {
+		switch n := hidden[sev]; {
+		case n == 1:
+			parts = append(parts, "1 "+sev.Label())
+		case n > 1:
+			parts = append(parts, fmt.Sprintf("%d %ss", n, sev.Label()))
+		}
+	}
+	if len(parts) == 0 {
+		return
+	}
+	fmt.Fprintf(r.w, "%s%s hidden (raise verbosity to show)%s\n",
+		r.style(colorDim),
+		strings.Join(parts, ", "),
+		r.style(colorReset),
+	)
+}
+
+// Returns d, or a copy of it whose range is canonicalized if it has a position.
+// File-only ranges are left alone so they keep rendering without a snippet.
+func canonicalized(d *Diagnostic) *Diagnostic {
+	if d.Range == nil || !d.Range.HasPosition() {
+		return d
+	}
+	sr := d.Range.Canonicalize()
+	if sr == *d.Range {
+		return d
+	}
+	c := *d
+	c.Range = &sr
+	return &c
+}
+
+// Outcome of admitting a diagnostic for reporting.
+type admission struct {
+	// The diagnostic must be printed.
+	print bool
+	// The diagnostic was added to the reported counts, which then totalled total.
+	counted bool
+	total   int
+	// The diagnostic is the first fatal or error one recorded.
+	firstError bool
+}
+
+// Applies the reporter's filters to a diagnostic that is about to be reported
+// and updates the counters, including those of result if non-nil.
+func (e *ErrorReporter) admit(d *Diagnostic, result *ReportManyResult) admission {
+	if e.DisabledSeverities[d.Severity] {
+		return admission{}
+	}
+	if e.MinSeverity != nil && d.Severity > *e.MinSeverity {
+		if result != nil {
+			result.Hidden[d.Severity]++
+		}
+		return admission{}
+	}
+	if e.FileFilter != nil && d.Range != nil && !e.FileFilter(d.Range.File) {
+		return admission{}
+	}
+	if e.isDuplicate(d) {
+		return admission{}
+	}
+	if d.Suppressed {
+		e.mu.Lock()
+		e.suppressed++
+		e.mu.Unlock()
+		if result != nil {
+			result.Suppressed++
+		}
+		return admission{print: e.ShowSuppressed}
+	}
+	total, firstError := e.record(d)
+	if result != nil {
+		result.Counts[d.Severity]++
+	}
+	return admission{print: true, counted: true, total: total, firstError: firstError}
+}
+
+// Returns true if DedupKey is set and a diagnostic with the same non-empty key
+// was already reported. The key is remembered on first sight.
+func (e *ErrorReporter) isDuplicate(d *Diagnostic) bool {
+	if e.DedupKey == nil {
+		return false
+	}
+	key := e.DedupKey(d)
+	if key == "" {
+		return false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.seenKeys[key] {
+		return true
+	}
+	if e.seenKeys == nil {
+		e.seenKeys = make(map[string]bool)
+	}
+	e.seenKeys[key] = true
+	return false
+}
+
+// Returns true if batch reporting must stop after this diagnostic.
+func (e *ErrorReporter) stopsAfter(d *Diagnostic) bool {
+	return e.StopOnFatal && d.Severity == SeverityFatal
+}
+
+// Wraps a writer to insert a prefix at the start of every line.
+type prefixWriter struct {
+	w           io.Writer
+	prefix      string
+	atLineStart bool
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	var buf []byte
+	for _, c := range b {
+		if p.atLineStart {
+			buf = append(buf, p.prefix...)
+		}
+		buf = append(buf, c)
+		p.atLineStart = c == '\n'
+	}
+	if _, err := p.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Wraps a writer to count bytes written and remember the first error.
+// Once a write fails, later writes are dropped.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// Counts the lines written through it, discarding the bytes.
+type lineCountingWriter struct {
+	lines int
+}
+
+func (l *lineCountingWriter) Write(p []byte) (int, error) {
+	l.lines += bytes.Count(p, []byte{'\n'})
+	return len(p), nil
+}
+
+// Reports the diagnostic and then terminates the process with exit code 1.
+// The abort is unconditional, regardless of the diagnostic's severity,
+// so this is meant for explicit call sites where processing cannot continue.
+func (e *ErrorReporter) ReportAndAbort(diagnostic *Diagnostic) {
+	e.Report(diagnostic)
+	e.abort(1)
+}
+
+// Convenience form of ReportAndAbort that builds a diagnostic from a format string.
+func (e *ErrorReporter) ReportfAndAbort(severity Severity, format string, args ...any) {
+	e.ReportAndAbort(NewDiagnostic(severity, fmt.Sprintf(format, args...)))
+}
+
+func (e *ErrorReporter) abort(code int) {
+	if e.abortFn == nil {
+		os.Exit(code)
+	}
+	e.abortFn(code)
+}
+
+// Reports multiple diagnostics like ReportMany, but displays single-character
+// diagnostics that point at the same source line together.
+// In the Fehler format the shared line is printed once, with a caret and message
+// for each diagnostic stacked beneath it. Other formats behave like ReportMany.
+func (e *ErrorReporter) ReportGrouped(diagnostics []*Diagnostic) {
+	if e.Format != FormatFehler {
+		e.ReportMany(diagnostics)
+		return
+	}
+
+	// Admit every diagnostic first, so groups only contain printed ones.
+	type admitted struct {
+		d *Diagnostic
+		a admission
+	}
+	result := ReportManyResult{Counts: make(map[Severity]int), Hidden: make(map[Severity]int)}
+	var entries []admitted
+	for _, d := range diagnostics {
+		a := e.admit(d, &result)
+		if !a.print {
+			continue
+		}
+		entries = append(entries, admitted{canonicalized(d), a})
+		if e.stopsAfter(d) {
+			break
+		}
+	}
+
+	groups := make(map[lineKey][]*Diagnostic)
+	for _, entry := range entries {
+		if key, ok := e.lineKeyOf(entry.d); ok {
+			groups[key] = append(groups[key], entry.d)
+		}
+	}
+
+	r := e.outputRenderer()
+	printed := make(map[lineKey]bool)
+	for _, entry := range entries {
+		e.writeMu.Lock()
+		key, ok := e.lineKeyOf(entry.d)
+		switch {
+		case !ok || len(groups[key]) < 2:
+			r.renderTee(entry.d)
+		case !printed[key]:
+			r.renderGroupTee(groups[key])
+			printed[key] = true
+		}
+		if entry.a.counted {
+			e.printSummary(r, entry.a.total)
+		}
+		e.writeMu.Unlock()
+
+		e.notify(entry.d, entry.a)
+	}
+
+	if e.ShowHiddenCount {
+		e.writeMu.Lock()
+		r.printHidden(result.Hidden)
+		e.writeMu.Unlock()
+	}
+}
+
+// Renders a line group through r and every renderer it tees to.
+// Renderers for formats other than Fehler print each diagnostic on its own.
+func (r *renderer) renderGroupTee(group []*Diagnostic) {
+	for _, out := range append([]*renderer{r}, r.tee...) {
+		if out.format != FormatFehler {
+			for _, d := range group {
+				out.render(d)
+			}
+			continue
+		}
+		out.printLineGroup(group)
+	}
+}
+
+// Identifies a single line in a source file.
+type lineKey struct {
+	file string
+	line int
+}
+
+// Returns the line a diagnostic can be grouped on, if it is a single-character
+// diagnostic pointing into a registered source.
+func (e *ErrorReporter) lineKeyOf(d *Diagnostic) (lineKey, bool) {
+	if d.Range == nil || !d.Range.HasPosition() || !d.Range.IsSingleChar() {
+		return lineKey{}, false
+	}
+	if _, ok := e.Sources[d.Range.File]; !ok {
+		return lineKey{}, false
+	}
+	return lineKey{file: d.Range.File, line: d.Range.Start.Line}, true
+}
+
+// Returns the number of suppressed diagnostics passed to the reporter,
+// whether or not they were shown.
+func (e *ErrorReporter) SuppressedCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.suppressed
+}
+
+// Stores a diagnostic for later instead of reporting it immediately.
+func (e *ErrorReporter) Collect(diagnostic *Diagnostic) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.collected = append(e.collected, diagnostic)
+}
+
+// Returns the diagnostics stored with Collect, in the order they were added.
+func (e *ErrorReporter) Collected() []*Diagnostic {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return slices.Clone(e.collected)
+}
+
+// Creates a diagnostic from a plain Go error, using its text as the message,
+// attaches the range, and stores it with Collect.
+func (e *ErrorReporter) WrapError(err error, severity Severity, r SourceRange) *Diagnostic {
+	d := NewDiagnostic(severity, err.Error()).WithRange(r)
+	e.Collect(d)
+	return d
+}
+
+// Returns the number of reported diagnostics for each severity.
+// The returned map is a snapshot and safe to modify.
+func (e *ErrorReporter) CountBySeverity() map[Severity]int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	counts := make(map[Severity]int, len(e.counts))
+	for sev, n := range e.counts {
+		counts[sev] = n
+	}
+	return counts
+}
+
+// Returns the total number of reported diagnostics across all severities.
+func (e *ErrorReporter) TotalDiagnosticCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	total := 0
+	for _, n := range e.counts {
+		total += n
+	}
+	return total
+}
+
+// Counts a diagnostic that is about to be reported.
+// Returns the total number of diagnostics counted so far, and whether d is
+// the first fatal or error diagnostic recorded.
+func (e *ErrorReporter) record(d *Diagnostic) (total int, firstError bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.counts == nil {
+		e.counts = make(map[Severity]int)
+	}
+	e.counts[d.Severity]++
+	for _, n := range e.counts {
+		total += n
+	}
+
+	if d.Severity <= SeverityError && !e.sawError {
+		e.sawError = true
+		firstError = true
+	}
+	return total, firstError
+}
+
+func (e *ErrorReporter) termWidth() int {
+	if e.TermWidth <= 0 {
+		return defaultTermWidth
+	}
+	return e.TermWidth
+}
+
+func (e *ErrorReporter) output() io.Writer {
+	if e.Writer == nil {
+		return os.Stdout
+	}
+	return e.Writer
+}
+
+// Renders the diagnostics to a string using the given output format.
+// The reporter's own Format is left untouched, so the same reporter can
+// produce several formats without any shared state being flipped.
+// Returns an error wrapping ErrUnsupportedFormat if format is not one of the
+// text formats; SARIF is written by EmitSarif instead.
+func (e *ErrorReporter) FormatAs(format OutputFormat, ds []*Diagnostic) (string, error) {
+	if !format.isValid() {
+		return "", fmt.Errorf("%w %d", ErrUnsupportedFormat, format)
+	}
+
+	var sb strings.Builder
+	e.renderAll(&sb, format, ds)
+	return sb.String(), nil
+}
+
+// Renders a diagnostic in the Fehler format as three separate sections, e.g. for
+// a TUI to lay out: the header (with any context line), the snippets of its ranges,
+// and the footer of notes, help, and documentation. Each section ends with a newline
+// unless empty. With HelpAfter, header + snippet + footer + "\n" equals the output of
+// FormatAs(FormatFehler); with HelpBefore the footer comes before the snippet.
+// Returns an error if d is nil.
+func (e *ErrorReporter) RenderParts(d *Diagnostic) (header, snippet, footer string, err error) {
+	if d == nil {
+		return "", "", "", fmt.Errorf("fehler: render parts of a nil diagnostic")
+	}
+	d = canonicalized(d)
+
+	part := func(print func(r *renderer)) string {
+		var sb strings.Builder
+		r := e.newRenderer(&sb, FormatFehler)
+		if d.Range != nil && d.InlineSource != "" {
+			r.inlineFile, r.inlineSource = d.Range.File, d.InlineSource
+		}
+		print(r)
+		return sb.String()
+	}
+	header = part(func(r *renderer) { r.printHeading(d) })
+	snippet = part(func(r *renderer) { r.printSnippets(d) })
+	footer = part(func(r *renderer) { r.printFooter(d) })
+	return header, snippet, footer, nil
+}
+
+// Renders the diagnostics in the reporter's format and returns the output as bytes,
+// e.g. to embed in an RPC response. Like FormatAs, no filters or counters apply.
+func (e *ErrorReporter) Bytes(ds []*Diagnostic) []byte {
+	var buf bytes.Buffer
+	e.renderAll(&buf, e.Format, ds)
+	return buf.Bytes()
+}
+
+func (e *ErrorReporter) renderAll(w io.Writer, format OutputFormat, ds []*Diagnostic) {
+	r := e.newRenderer(w, format)
+	for _, d := range ds {
+		r.render(d)
+	}
+}
+
+// Checks that every diagnostic's range refers to a registered or inline source
+// and that its lines exist in that source, as a pre-flight check before reporting.
+// Returns one error per diagnostic that fails, in order. Diagnostics without a
+// range are skipped, and spots are checked with ValidateSpots.
+func (e *ErrorReporter) Validate(ds []*Diagnostic) []error {
+	var errs []error
+	for _, d := range ds {
+		if d.Range == nil {
+			continue
+		}
+		if err := e.validateRange(d); err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", d.ResolvedMessage(), err))
+		} else if err := d.ValidateSpots(); err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", d.ResolvedMessage(), err))
+		}
+	}
+	return errs
+}
+
+func (e *ErrorReporter) validateRange(d *Diagnostic) error {
+	sr := *d.Range
+	source, ok := e.Sources[sr.File]
+	if !ok && d.InlineSource != "" {
+		source, ok = d.InlineSource, true
+	}
+	if !ok {
+		return fmt.Errorf("fehler: no source registered for %q", sr.File)
+	}
+	if !sr.HasPosition() {
+		return nil
+	}
+	lines := strings.Count(source, "\n")
+	if !strings.HasSuffix(source, "\n") {
+		lines++
+	}
+	if last := sr.Normalize().End.Line; last > lines {
+		return fmt.Errorf("fehler: line %d is past the end of %q (%d lines)", last, sr.File, lines)
+	}
+	return nil
+}
+
+// Returns the number of terminal lines d occupies when rendered with the
+// reporter's current format and options, including the trailing blank line.
+// Nothing is written or counted. Lines wider than the terminal are counted once.
+func (e *ErrorReporter) RenderedHeight(d *Diagnostic) int {
+	var lc lineCountingWriter
+	e.newRenderer(&lc, e.Format).render(d)
+	return lc.lines
+}
+
+// Width of the line number column in source snippets.
+const lineNumWidth = 4
+
+// Number of notes or secondary ranges shown per diagnostic by default.
+const defaultMaxGroupSize = 5
+
+// Terminal width assumed when none is configured.
+const defaultTermWidth = 80
+
+// Holds the state of a single rendering pass.
+// Output options are resolved here so that rendering never mutates the reporter.
+type renderer struct {
+	e       *ErrorReporter
+	w       io.Writer
+	format  OutputFormat
+	noColor bool
+
+	// Source carried by the diagnostic being rendered, for its primary file.
+	inlineFile   string
+	inlineSource string
+
+	// Codes whose help was already printed in this pass, for DedupeHelp.
+	helpShown map[string]bool
+
+	// Renderers for the outputs added with AddFormat, which also get every reported diagnostic.
+	tee []*renderer
+}
+
+// A format and writer pair added with AddFormat.
+type formatOutput struct {
+	format OutputFormat
+	w      io.Writer
+}
+
+// Returns a renderer for the reporter's writer and format that also renders
+// to every output added with AddFormat.
+func (e *ErrorReporter) outputRenderer() *renderer {
+	r := e.newRenderer(e.output(), e.Format)
+	for _, out := range e.extraOutputs {
+		r.tee = append(r.tee, e.newRenderer(out.w, out.format))
+	}
+	return r
+}
+
+func (e *ErrorReporter) newRenderer(w io.Writer, format OutputFormat) *renderer {
+	if e.IndentPrefix != "" {
+		w = &prefixWriter{w: w, prefix: e.IndentPrefix, atLineStart: true}
+	}
+	return &renderer{
+		e:       e,
+		w:       w,
+		format:  format,
+		noColor: e.NoColor,
+	}
+}
+
+// Returns the ANSI code unless color is disabled for this pass.
+func (r *renderer) style(code string) string {
+	if r.noColor {
+		return ""
+	}
+	return code
+}
+
+// Returns the styled color for a diagnostic's severity.
+// Suppressed diagnostics are dimmed.
+func (r *renderer) severityColor(d *Diagnostic) string {
+	if d.Suppressed {
+		return r.style(colorDim)
+	}
+	return r.style(d.Severity.Color())
+}
+
+// Returns the severity label for a Fehler header, right-aligned to the
+// longest label when AlignLabels is set and preceded by its icon when UseIcons is set.
+func (r *renderer) label(sev Severity) string {
+	label := sev.Label()
+	if r.e.AlignLabels {
+		label = fmt.Sprintf("%*s", maxLabelWidth(), label)
+	}
+	if r.e.UseIcons {
+		ic := r.e.IconStyle.icon(sev)
+		text := ic.text
+		if r.e.AlignLabels {
+			text += strings.Repeat(" ", maxIconWidth(r.e.IconStyle)-ic.width)
+		}
+		label = text + " " + label
+	}
+	return label
+}
+
+// Returns the number of columns of the widest icon in style.
+func maxIconWidth(style IconStyle) int {
+	width := 0
+	for sev := SeverityFatal; sev <= SeveritySuccess; sev++ {
+		width = max(width, style.icon(sev).width)
+	}
+	return width
+}
+
+// Returns the length of the longest severity label.
+func maxLabelWidth() int {
+	width := 0
+	for sev := SeverityFatal; sev <= SeveritySuccess; sev++ {
+		width = max(width, len(sev.Label()))
+	}
+	return width
+}
+
+// Returns the color for a diagnostic's underline: UnderlineColor when set,
+// otherwise the severity color. Suppressed diagnostics are always dimmed.
+func (r *renderer) underlineColor(d *Diagnostic) string {
+	if r.e.UnderlineColor == "" || d.Suppressed {
+		return r.severityColor(d)
+	}
+	return r.style(r.e.UnderlineColor)
+}
+
+// Returns the message of d translated into its MessageLocale by MessageCatalog,
+// using Message as the lookup key, with any arguments from WithArgs substituted.
+// Falls back to ResolvedMessage when no locale or catalog is set or the catalog
+// has no translation.
+func (e *ErrorReporter) FormattedMessage(d *Diagnostic) string {
+	if d.MessageLocale == "" || e.MessageCatalog == nil {
+		return d.ResolvedMessage()
+	}
+	translated := e.MessageCatalog(d.MessageLocale, d.Message)
+	if translated == "" {
+		return d.ResolvedMessage()
+	}
+	if len(d.messageArgs) == 0 {
+		return translated
+	}
+	return fmt.Sprintf(translated, d.messageArgs...)
+}
+
+// Returns the message text to render for a diagnostic.
+func (r *renderer) message(d *Diagnostic) string {
+	msg := r.e.FormattedMessage(d)
+	if d.Suppressed {
+		msg += " (suppressed)"
+	}
+	return msg
+}
+
+// Returns the message for a diagnostic's own header line, with the reporter's MessagePrefix.
+// Notes and inline labels use message, without the prefix.
+func (r *renderer) headline(d *Diagnostic) string {
+	return r.e.MessagePrefix + r.message(d)
+}
+
+// Renders a diagnostic in the renderer's format. The primary range is
+// canonicalized first, so every render path shows the same positions.
+func (r *renderer) render(diagnostic *Diagnostic) {
+	diagnostic = canonicalized(diagnostic)
+	switch r.format {
+	case FormatFehler:
+		if r.isBare(diagnostic) {
+			r.printBare(r.label(diagnostic.Severity), diagnostic, "\n\n")
+			return
+		}
+		r.printFehler(diagnostic)
+	case FormatGCC:
+		if r.isBare(diagnostic) {
+			r.printBare(diagnostic.Severity.Label(), diagnostic, "\n")
+			return
+		}
+		r.printGcc(diagnostic)
+	case FormatMSVC:
+		r.printMsvc(diagnostic)
+	case FormatMessageOnly:
+		r.printMessageOnly(diagnostic)
+	}
+}
+
+// Returns true if the diagnostic renders as a single "label: message" line,
+// with color off and nothing but a severity and message to show.
+func (r *renderer) isBare(d *Diagnostic) bool {
+	return r.noColor &&
+		d.Range == nil && d.Help == nil && d.Url == nil && d.Code == nil &&
+		d.ContextMessage == nil && len(d.Notes) == 0 && len(d.SecondaryRanges) == 0 &&
+		len(d.Related) == 0 && len(d.Suggestions) == 0
+}
+
+// Writes a bare diagnostic as label, message, and end in a single write, skipping
+// the printf and style formatting of the full printers, which produce the same text.
+func (r *renderer) printBare(label string, d *Diagnostic, end string) {
+	message := r.headline(d)
+	var sb strings.Builder
+	sb.Grow(len(label) + 2 + len(message) + len(end))
+	sb.WriteString(label)
+	sb.WriteString(": ")
+	sb.WriteString(message)
+	sb.WriteString(end)
+	io.WriteString(r.w, sb.String())
+}
+
+func (r *renderer) printFehler(diagnostic *Diagnostic) {
+	if diagnostic.Range != nil && diagnostic.InlineSource != "" {
+		r.inlineFile, r.inlineSource = diagnostic.Range.File, diagnostic.InlineSource
+		defer func() { r.inlineFile, r.inlineSource = "", "" }()
+	}
+
+	r.printHeading(diagnostic)
+
+	if r.e.HelpPosition == HelpBefore {
+		r.printFooter(diagnostic)
+	}
+
+	r.printSnippets(diagnostic)
+
+	if r.e.HelpPosition == HelpAfter {
+		r.printFooter(diagnostic)
+	}
+
+	fmt.Fprintln(r.w)
+}
+
+// Prints the context line, if any, and the header of a diagnostic.
+func (r *renderer) printHeading(diagnostic *Diagnostic) {
+	if diagnostic.ContextMessage != nil {
+		fmt.Fprintf(r.w, "  %s%scontext: %s%s\n",
+			r.style(colorDim),
+			r.style(colorWhite),
+			*diagnostic.ContextMessage,
+			r.style(colorReset),
+		)
+	}
+
+	r.printHeader(diagnostic)
+}
+
+// Prints the primary range, suggestion diffs, secondary ranges, and related
+// ranges of a diagnostic, each with its snippet.
+func (r *renderer) printSnippets(diagnostic *Diagnostic) {
+	if diagnostic.Range != nil {
+		var ghosts []Suggestion
+		if r.e.ShowGhostText {
+			ghosts = diagnostic.Suggestions
+		}
+		r.printRange(*diagnostic.Range, r.underlineColor(diagnostic), ghosts, diagnostic.Spots)
+	}
+
+	if r.e.ShowSuggestionDiff {
+		for _, s := range diagnostic.Suggestions {
+			r.printSuggestionDiff(s)
+		}
+	}
+
+	secondaryColor := r.style(colorDim) + r.style(colorCyan)
+	secondary, hidden := r.capGroup(len(diagnostic.SecondaryRanges))
+	for _, sr := range diagnostic.SecondaryRanges[:secondary] {
+		r.printRange(sr, secondaryColor, nil, nil)
+	}
+	r.printMore(hidden)
+
+	for _, rel := range diagnostic.Related {
+		if rel.Message != "" {
+			fmt.Fprintf(r.w, "  %s↳%s  %s\n", r.style(colorCyan), r.style(colorReset), rel.Message)
+		}
+		r.printRange(rel.Range, secondaryColor, nil, nil)
+	}
+}
+
+// Prints a suggestion as a diff hunk of the whole lines it touches.
+// Suggestions whose source is unknown or out of range are skipped.
+func (r *renderer) printSuggestionDiff(s Suggestion) {
+	source, ok := r.source(s.Range.File)
+	if !ok {
+		return
+	}
+	ed, err := resolveEdit(source, s)
+	if err != nil {
+		return
+	}
+
+	lineStart := strings.LastIndexByte(source[:ed.start], '\n') + 1
+	lineEnd := len(source)
+	if i := strings.IndexByte(source[ed.end:], '\n'); i >= 0 {
+		lineEnd = ed.end + i
+	}
+	before := source[lineStart:lineEnd]
+	after := source[lineStart:ed.start] + ed.replacement + source[ed.end:lineEnd]
+
+	fmt.Fprintf(r.w, "  %ssuggestion:%s %s\n", r.style(colorBold), r.style(colorReset), r.displayRange(s.Range))
+	for _, line := range strings.Split(before, "\n") {
+		fmt.Fprintf(r.w, "    %s- %s%s\n", r.style(colorRed), line, r.style(colorReset))
+	}
+	for _, line := range strings.Split(after, "\n") {
+		fmt.Fprintf(r.w, "    %s+ %s%s\n", r.style(colorGreen), line, r.style(colorReset))
+	}
+}
+
+// Prints the location line for a range followed by its highlighted snippet.
+// Ranges without a known position only print the file name.
+// Ghosts are suggestions previewed as ghost text under the lines they replace,
+// and spots are extra highlights merged into the underline of a single-line range.
+func (r *renderer) printRange(sr SourceRange, color string, ghosts []Suggestion, spots []SourceRange) {
+	if !sr.HasPosition() {
+		fmt.Fprintf(r.w, "  %s%s%s%s\n",
+			r.style(colorCyan),
+			r.style(colorBold),
+			sr.File,
+			r.style(colorReset),
+		)
+		return
+	}
+
+	sr = sr.Normalize()
+	fmt.Fprintf(r.w, "  %s%s%s:%s%s%s\n",
+		r.style(colorCyan),
+		r.style(colorBold),
+		sr.File,
+		r.location(sr),
+		r.style(colorReset),
+		r.offsetSuffix(sr),
+	)
+
+	if _, ok := r.source(sr.File); !ok && r.e.ContextLineProvider == nil && isRemoteURI(sr.File) {
+		fmt.Fprintf(r.w, "  %s%ssee%s: %s\n", r.style(colorCyan), r.style(colorBold), r.style(colorReset), sr.File)
+		return
+	}
+
+	r.printSourceSnippet(sr, ghosts, func(lineNum int) []underlineRow {
+		row := underlineFor(sr, lineNum, color)
+		if !sr.IsMultiline() {
+			for _, spot := range spots {
+				if spot.File == sr.File && spot.Start.Line == lineNum {
+					row.marks = overlayMarks(row.marks, spot)
+				}
+			}
+		}
+		return []underlineRow{row}
+	})
+}
+
+// Returns the position part of a location line, "line:col" for the range start.
+// With ShowRangeInLocation, a single-line span shows as "line:start-end" and
+// a multiline range as "line:col - line:col".
+func (r *renderer) location(sr SourceRange) string {
+	start := fmt.Sprintf("%d:%d", r.displayLine(sr.Start.Line), sr.Start.Column)
+	if !r.e.ShowRangeInLocation || sr.IsSingleChar() {
+		return start
+	}
+	if !sr.IsMultiline() {
+		return fmt.Sprintf("%s-%d", start, sr.End.Column)
+	}
+	return fmt.Sprintf("%s - %d:%d", start, r.displayLine(sr.End.Line), sr.End.Column)
+}
+
+// Returns a 1-based line number as it is displayed, shifted down by one if ZeroBasedLines is set.
+func (r *renderer) displayLine(line int) int {
+	if r.e.ZeroBasedLines {
+		return line - 1
+	}
+	return line
+}
+
+// Returns a copy of sr with its line numbers shifted for display.
+func (r *renderer) displayRange(sr SourceRange) *SourceRange {
+	sr = sr.Normalize()
+	sr.Start.Line = r.displayLine(sr.Start.Line)
+	sr.End.Line = r.displayLine(sr.End.Line)
+	return &sr
+}
+
+// Returns the registered source of file, or the inline source of the
+// diagnostic being rendered if it belongs to that file.
+func (r *renderer) source(file string) (string, bool) {
+	if source, ok := r.e.Sources[file]; ok {
+		return source, true
+	}
+	if r.hasInlineSource(file) {
+		return r.inlineSource, true
+	}
+	return "", false
+}
+
+// Returns true if the diagnostic being rendered carries its own source for file.
+func (r *renderer) hasInlineSource(file string) bool {
+	return r.inlineSource != "" && r.inlineFile == file
+}
+
+// Returns " (offset N)" for the start of sr when ShowOffset is set and the
+// position exists in its registered source, or "" otherwise.
+func (r *renderer) offsetSuffix(sr SourceRange) string {
+	if !r.e.ShowOffset {
+		return ""
+	}
+	source, ok := r.source(sr.File)
+	if !ok {
+		return ""
+	}
+	offset, ok := offsetOf(source, sr.Start)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" %s(offset %d)%s", r.style(colorDim), offset, r.style(colorReset))
+}
+
+// Returns true if file is an http or https URI rather than a local path.
+func isRemoteURI(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://")
+}
+
+// Prints several single-character diagnostics on the same line as one block.
+// Headers come first, then the shared source line with one caret row per
+// diagnostic (ordered by column), then each diagnostic's help lines.
+func (r *renderer) printLineGroup(group []*Diagnostic) {
+	sorted := slices.Clone(group)
+	slices.SortStableFunc(sorted, func(a, b *Diagnostic) int {
+		return a.Range.Start.Column - b.Range.Start.Column
+	})
+
+	for _, d := range group {
+		r.printHeading(d)
+	}
+
+	first := sorted[0].Range
+	fmt.Fprintf(r.w, "  %s%s%s:%d%s\n",
+		r.style(colorCyan),
+		r.style(colorBold),
+		first.File,
+		r.displayLine(first.Start.Line),
+		r.style(colorReset),
+	)
+
+	r.printSourceSnippet(*first, nil, func(lineNum int) []underlineRow {
+		rows := make([]underlineRow, 0, len(sorted))
+		for _, d := range sorted {
+			rows = append(rows, underlineRow{
+				color: r.underlineColor(d),
+				marks: strings.Repeat(" ", d.Range.Start.Column-1) + "^",
+				label: r.message(d),
+			})
+		}
+		return rows
+	})
+
+	for _, d := range group {
+		r.printFooter(d)
+	}
+
+	fmt.Fprintln(r.w)
+}
+
+// Prints the severity label, optional code, and message line.
+func (r *renderer) printHeader(diagnostic *Diagnostic) {
+	if diagnostic.Code != nil {
+		code := *diagnostic.Code
+		if change := r.e.severityChange(diagnostic); change != "" {
+			code += ", " + change
+		}
+		fmt.Fprintf(r.w, "%s%s%s[%s]%s: %s\n",
+			r.severityColor(diagnostic),
+			r.style(colorBold),
+			r.label(diagnostic.Severity),
+			code,
+			r.style(colorReset),
+			r.headline(diagnostic),
+		)
+	} else {
+		fmt.Fprintf(r.w, "%s%s%s%s: %s\n",
+			r.severityColor(diagnostic),
+			r.style(colorBold),
+			r.label(diagnostic.Severity),
+			r.style(colorReset),
+			r.headline(diagnostic),
+		)
+	}
+}
+
+// Returns the documentation URL for a diagnostic: its Url if set, otherwise
+// DocURLTemplate with "{code}" replaced by its code.
+func (e *ErrorReporter) docURL(d *Diagnostic) (string, bool) {
+	if d.Url != nil {
+		return *d.Url, true
+	}
+	if d.Code != nil && e.DocURLTemplate != "" {
+		return strings.ReplaceAll(e.DocURLTemplate, "{code}", *d.Code), true
+	}
+	return "", false
+}
+
+// Splits n grouped items into how many to print and how many to collapse,
+// according to MaxGroupSize.
+func (r *renderer) capGroup(n int) (shown, hidden int) {
+	if limit := r.e.MaxGroupSize; limit > 0 && n > limit {
+		return limit, n - limit
+	}
+	return n, 0
+}
+
+// Prints the line standing in for collapsed group items, if any.
+func (r *renderer) printMore(hidden int) {
+	if hidden > 0 {
+		fmt.Fprintf(r.w, "  %s... %d more (use -v to show all)%s\n", r.style(colorDim), hidden, r.style(colorReset))
+	}
+}
+
+// Prints the notes, help, and documentation lines that follow the snippet.
+func (r *renderer) printFooter(diagnostic *Diagnostic) {
+	notes, hidden := r.capGroup(len(diagnostic.Notes))
+	for _, note := range diagnostic.Notes[:notes] {
+		fmt.Fprintf(r.w, "  %s%snote%s: %s\n", r.severityColor(note), r.style(colorBold), r.style(colorReset), r.message(note))
+		if note.Range != nil {
+			r.printRange(*note.Range, r.underlineColor(note), nil, nil)
+		}
+	}
+	r.printMore(hidden)
+
+	url, hasURL := r.e.docURL(diagnostic)
+	if r.helpSeen(diagnostic, diagnostic.Help != nil || hasURL) {
+		fmt.Fprintf(r.w, "  %shelp: (see above)%s\n", r.style(colorDim), r.style(colorReset))
+		return
+	}
+
+	if diagnostic.Help != nil {
+		fmt.Fprintf(r.w, "  %s%shelp%s: %s\n", r.style(colorCyan), r.style(colorBold), r.style(colorReset), *diagnostic.Help)
+	}
+
+	if hasURL {
+		fmt.Fprintf(r.w, "  %s%ssee%s: %s\n", r.style(colorCyan), r.style(colorBold), r.style(colorReset), url)
+	}
+}
+
+// Returns true if DedupeHelp is set and help for the diagnostic's code was
+// already printed in this pass. Otherwise, remembers the code if it has help.
+func (r *renderer) helpSeen(d *Diagnostic, hasHelp bool) bool {
+	if !r.e.DedupeHelp || d.Code == nil || !hasHelp {
+		return false
+	}
+	if r.helpShown[*d.Code] {
+		return true
+	}
+	if r.helpShown == nil {
+		r.helpShown = make(map[string]bool)
+	}
+	r.helpShown[*d.Code] = true
+	return false
+}
+
+func (r *renderer) printGcc(diagnostic *Diagnostic) {
+	color := r.severityColor(diagnostic)
+	if diagnostic.Range != nil && !diagnostic.Range.HasPosition() {
+		fmt.Fprintf(r.w, "%s%s: %s%s: %s%s%s%s\n",
+			r.style(colorBold),
+			diagnostic.Range.File,
+			color,
+			diagnostic.Severity.Label(),
+			r.style(colorReset),
+			r.style(colorBold),
+			r.headline(diagnostic),
+			r.style(colorReset),
+		)
+	} else if diagnostic.Range != nil {
+		fmt.Fprintf(r.w, "%s%s: %s%s: %s%s%s%s\n",
+			r.style(colorBold),
+			r.displayRange(*diagnostic.Range).ToGCCString(),
+			color,
+			diagnostic.Severity.Label(),
+			r.style(colorReset),
+			r.style(colorBold),
+			r.headline(diagnostic),
+			r.style(colorReset),
+		)
+	} else {
+		fmt.Fprintf(r.w, "%s%s%s: %s%s%s%s\n",
+			r.style(colorBold),
+			color,
+			diagnostic.Severity.Label(),
+			r.style(colorReset),
+			r.style(colorBold),
+			r.headline(diagnostic),
+			r.style(colorReset),
+		)
+	}
+}
+
+func (r *renderer) printMessageOnly(diagnostic *Diagnostic) {
+	code := ""
+	if diagnostic.Code != nil {
+		code = "[" + *diagnostic.Code + "]"
+	}
+	fmt.Fprintf(r.w, "%s%s%s%s: %s\n",
+		r.severityColor(diagnostic),
+		diagnostic.Severity.Label(),
+		code,
+		r.style(colorReset),
+		r.headline(diagnostic),
+	)
+}
+
+func (r *renderer) printMsvc(diagnostic *Diagnostic) {
+	code := "unknown"
+	if diagnostic.Code != nil {
+		code = *diagnostic.Code
+	}
+
+	if diagnostic.Range != nil && !diagnostic.Range.HasPosition() {
+		fmt.Fprintf(r.w, "%s: %s %s: %s\n",
+			diagnostic.Range.File,
+			diagnostic.Severity.Label(),
+			code,
+			r.headline(diagnostic),
+		)
+	} else if diagnostic.Range != nil {
+		fmt.Fprintf(r.w, "%s: %s %s: %s\n",
+			r.displayRange(*diagnostic.Range).ToMSVCString(),
+			diagnostic.Severity.Label(),
+			code,
+			r.headline(diagnostic),
+		)
+	} else {
+		fmt.Fprintf(r.w, "%s: %s\n",
+			diagnostic.Severity.Label(),
+			r.headline(diagnostic),
+		)
+	}
+}
+
+// Prints a source code snippet showing the context around a diagnostic range.
+// Shows 2 lines before and after the error location. After each line covered by
+// the range, the rows returned by the underline callback are printed to highlight it.
+// Lines longer than WrapWidth are wrapped, with each underline row split to match.
+func (r *renderer) printSourceSnippet(sr SourceRange, ghosts []Suggestion, underline func(lineNum int) []underlineRow) {
+	contextStart := 1
+	if sr.Start.Line > 2 {
+		contextStart = sr.Start.Line - 2
+	}
+
+	contextEnd := sr.Start.Line + 2
+	if sr.IsMultiline() {
+		contextEnd = sr.End.Line + 2
+	}
+
+	var lines []string
+	var lastLine int
+	if r.e.ContextLineProvider != nil && !r.hasInlineSource(sr.File) {
+		provider := r.e.ContextLineProvider
+		provided, err := provider(sr.File, contextStart, contextEnd)
+		if err != nil {
+			fmt.Fprintf(r.w, "  %s(source unavailable: %v)%s\n", r.style(colorDim), err, r.style(colorReset))
+			return
+		}
+		// Pad so that lines[n-1] is still line n. The provider does not say
+		// how long the file is, so no trailing ellipsis is printed.
+		lines = append(make([]string, contextStart-1), provided...)
+		lastLine = len(lines)
+	} else {
+		source, ok := r.source(sr.File)
+		if !ok {
+			return
+		}
+		lines = strings.Split(source, "\n")
+		lastLine = len(lines)
+		if strings.HasSuffix(source, "\n") {
+			lastLine--
+		}
+	}
+	if contextEnd > len(lines) {
+		contextEnd = len(lines)
+	}
+
+	if r.e.ShowEllipsis && contextStart > 1 {
+		r.printEllipsis()
+	}
+
+	var keywords map[string]bool
+	if r.e.SyntaxHighlighting && !r.noColor {
+		keywords = keywordsFor(r.e.Languages[sr.File])
+	}
+
+	omitFrom, omitTo := r.omittedLines(sr)
+
+	for currentLine := contextStart; currentLine <= contextEnd; currentLine++ {
+		if currentLine == omitFrom {
+			fmt.Fprintf(r.w, "  %s... %d lines omitted ...%s\n", r.style(colorDim), omitTo-omitFrom+1, r.style(colorReset))
+			currentLine = omitTo
+			continue
+		}
+
+		if run := r.repeatRun(lines, sr, currentLine, contextEnd, omitFrom); run > 0 {
+			fmt.Fprintf(r.w, "  %s⋮ (%d identical lines)%s\n", r.style(colorDim), run, r.style(colorReset))
+			currentLine += run - 1
+			continue
+		}
+
+		isErrorLine := currentLine >= sr.Start.Line && currentLine <= sr.End.Line
+
+		line := lines[currentLine-1]
+		var rows []underlineRow
+		if isErrorLine {
+			rows = underline(currentLine)
+			if r.e.TabWidth > 0 {
+				for j := range rows {
+					rows[j].marks = expandMarks(line, rows[j].marks, r.e.TabWidth)
+				}
+			}
+		}
+
+		display, hidden := r.truncateLine(expandTabs(line, r.e.TabWidth))
+		if hidden > 0 {
+			width := r.e.MaxLineWidth
+			at := min(max(width-utf8.RuneCountInString(r.e.TruncationIndicator), 0), width-1)
+			for j := range rows {
+				rows[j].marks = clipMarks(rows[j].marks, width, at)
+			}
+		}
+
+		fragments := wrapLine(display, r.e.WrapWidth)
+		for i, fragment := range fragments {
+			if keywords != nil {
+				fragment = highlightKeywords(fragment, keywords, colorBold, colorReset)
+			}
+			if i == len(fragments)-1 {
+				fragment += r.truncationSuffix(hidden)
+			}
+
+			switch {
+			case i > 0:
+				fmt.Fprintf(r.w, "  %s%s %s%s %s\n",
+					r.style(colorDim),
+					strings.Repeat(" ", lineNumWidth),
+					r.gutter(),
+					r.style(colorReset),
+					fragment,
+				)
+			case isErrorLine:
+				fmt.Fprintf(r.w, "  %s%s%4d %s%s %s\n",
+					r.style(colorRed),
+					r.style(colorBold),
+					r.displayLine(currentLine),
+					r.gutter(),
+					r.style(colorReset),
+					fragment,
+				)
+			default:
+				fmt.Fprintf(r.w, "  %s%4d %s%s %s\n",
+					r.style(colorDim),
+					r.displayLine(currentLine),
+					r.gutter(),
+					r.style(colorReset),
+					fragment,
+				)
+			}
+
+			if i == len(fragments)-1 {
+				for _, g := range ghosts {
+					if ghost, ok := ghostLine(line, currentLine, sr.File, g); ok {
+						ghost = expandTabs(ghost, r.e.TabWidth)
+						fmt.Fprintf(r.w, "  %s %s%s %s%s\n",
+							strings.Repeat(" ", lineNumWidth),
+							r.gutter(),
+							r.style(colorDim),
+							ghost,
+							r.style(colorReset),
+						)
+					}
+				}
+			}
+
+			for _, row := range rows {
+				r.printUnderlineRow(row, i, len(fragments))
+			}
+		}
+	}
+
+	if r.e.ShowEllipsis && contextEnd < lastLine {
+		r.printEllipsis()
+	}
+}
+
+// Returns the first and last line of sr to fold away when it spans more than
+// MaxSnippetLines lines, always keeping the first and last lines of the range,
+// even when the limit is 1. Returns 0, 0 when nothing is omitted.
+func (r *renderer) omittedLines(sr SourceRange) (int, int) {
+	limit := r.e.MaxSnippetLines
+	if limit <= 0 || sr.End.Line-sr.Start.Line+1 <= limit {
+		return 0, 0
+	}
+	tail := max(limit/2, 1)
+	head := max(limit-tail, 1)
+	from, to := sr.Start.Line+head, sr.End.Line-tail
+	if from > to {
+		return 0, 0
+	}
+	return from, to
+}
+
+// Returns the length of the run of identical lines starting at from when
+// CollapseRepeats is set and the run is at least three lines long, or 0.
+// The run stops before the first and last line of sr, the end of the
+// snippet, and any folded lines, so those are never collapsed.
+func (r *renderer) repeatRun(lines []string, sr SourceRange, from, last, omitFrom int) int {
+	if !r.e.CollapseRepeats {
+		return 0
+	}
+	collapsible := func(line int) bool {
+		return line <= last && line != sr.Start.Line && line != sr.End.Line && line != omitFrom
+	}
+	if !collapsible(from) {
+		return 0
+	}
+	run := 1
+	for collapsible(from+run) && lines[from+run-1] == lines[from-1] {
+		run++
+	}
+	if run < 3 {
+		return 0
+	}
+	return run
+}
+
+// Returns line number lineNum of file with the suggestion applied, or false if
+// the suggestion does not replace text on exactly that line.
+func ghostLine(line string, lineNum int, file string, s Suggestion) (string, bool) {
+	sr := s.Range.Normalize()
+	if sr.File != file || sr.IsMultiline() || sr.Start.Line != lineNum || !sr.HasPosition() {
+		return "", false
+	}
+
+	runes := []rune(line)
+	start := min(sr.Start.Column-1, len(runes))
+	end := min(sr.End.Column, len(runes))
+	return string(runes[:start]) + s.Replacement + string(runes[end:]), true
+}
+
+// Returns the 1-based display column of rune column col in line, with tabs
+// advancing to the next multiple of tabWidth. Columns past the end of the line
+// continue one per column. A tabWidth of 0 or less leaves columns unchanged.
+func visualColumn(line string, col, tabWidth int) int {
+	if tabWidth <= 0 {
+		return col
+	}
+	visual, c := 0, 1
+	for _, ch := range line {
+		if c == col {
+			return visual + 1
+		}
+		if ch == '\t' {
+			visual += tabWidth - visual%tabWidth
+		} else {
+			visual++
+		}
+		c++
+	}
+	return visual + 1 + col - c
+}
+
+// Replaces tabs in line with spaces up to the next tab stop.
+// A tabWidth of 0 or less leaves the line unchanged.
+func expandTabs(line string, tabWidth int) string {
+	if tabWidth <= 0 || !strings.Contains(line, "\t") {
+		return line
+	}
+	var sb strings.Builder
+	visual := 0
+	for _, ch := range line {
+		if ch == '\t' {
+			n := tabWidth - visual%tabWidth
+			sb.WriteString(strings.Repeat(" ", n))
+			visual += n
+		} else {
+			sb.WriteRune(ch)
+			visual++
+		}
+	}
+	return sb.String()
+}
+
+// Moves underline marks from rune columns of line to display columns after
+// expandTabs. A tilde under a tab is widened to cover the whole tab.
+func expandMarks(line, marks string, tabWidth int) string {
+	var out []rune
+	for i, m := range []rune(marks) {
+		if m == ' ' {
+			continue
+		}
+		start := visualColumn(line, i+1, tabWidth) - 1
+		end := visualColumn(line, i+2, tabWidth) - 1
+		for len(out) < end {
+			out = append(out, ' ')
+		}
+		out[start] = m
+		if m == '~' {
+			for j := start + 1; j < end; j++ {
+				out[j] = m
+			}
+		}
+	}
+	return string(out)
+}
+
+// Shortens a display line to MaxLineWidth runes, ending it with the
+// truncation indicator. Returns the line to print and the number of runes cut off.
+func (r *renderer) truncateLine(line string) (string, int) {
+	limit := r.e.MaxLineWidth
+	runes := []rune(line)
+	if limit <= 0 || len(runes) <= limit {
+		return line, 0
+	}
+
+	indicator := r.e.TruncationIndicator
+	kept := max(limit-utf8.RuneCountInString(indicator), 0)
+	return string(runes[:kept]) + indicator, len(runes) - kept
+}
+
+// Returns the dimmed "[+N chars]" count that follows a truncated line, or ""
+// if nothing was cut off or ShowTruncationColumn is off. It is appended after
+// wrapping and highlighting, so it never counts towards the line width.
+func (r *renderer) truncationSuffix(hidden int) string {
+	if hidden == 0 || !r.e.ShowTruncationColumn {
+		return ""
+	}
+	return fmt.Sprintf(" %s[+%d chars]%s", r.style(colorDim), hidden, r.style(colorReset))
+}
+
+// Cuts underline marks off after width columns.
+// If every mark falls after the cut, a caret is drawn at offset at instead,
+// under the truncation indicator, so the location is not lost.
+func clipMarks(marks string, width, at int) string {
+	runes := []rune(marks)
+	if len(runes) <= width {
+		return marks
+	}
+	clipped := string(runes[:width])
+	if strings.TrimSpace(clipped) == "" && strings.TrimSpace(marks) != "" {
+		return strings.Repeat(" ", at) + "^"
+	}
+	return clipped
+}
+
+// Splits a line into fragments of at most width runes.
+// A width of 0 or less disables wrapping.
+func wrapLine(line string, width int) []string {
+	runes := []rune(line)
+	if width <= 0 || len(runes) <= width {
+		return []string{line}
+	}
+
+	var fragments []string
+	for len(runes) > width {
+		fragments = append(fragments, string(runes[:width]))
+		runes = runes[width:]
+	}
+	return append(fragments, string(runes))
+}
+
+// Marks lines omitted from a snippet.
+func (r *renderer) printEllipsis() {
+	fmt.Fprintf(r.w, "  %s...%s\n", r.style(colorDim), r.style(colorReset))
+}
+
+// Returns the character separating line numbers from source text, "|" by default.
+func (r *renderer) gutter() string {
+	if r.e.GutterChar == "" {
+		return "|"
+	}
+	return r.e.GutterChar
+}
+
+// One row printed beneath a source line.
+// Marks are aligned to the line's columns, starting at column 1, and the label
+// follows the last mark, joined to it with "--" when attached is set.
+type underlineRow struct {
+	color    string
+	marks    string
+	label    string
+	attached bool
+}
+
+// Returns the underline (carets or tildes) for a specific line in a range.
+// If the range has a label, it is attached to the last line of the range;
+// a single-character range points at it with "^-- label".
+// Inverted ranges are normalized first, so Start always marks the first underlined line.
+func underlineFor(sr SourceRange, lineNum int, color string) underlineRow {
+	sr = sr.Normalize()
+	var marks strings.Builder
+	if sr.IsMultiline() {
+		if lineNum == sr.Start.Line {
+			marks.WriteString(strings.Repeat(" ", sr.Start.Column-1))
+			marks.WriteString("~")
+			marks.WriteString(strings.Repeat("~", max(80-sr.Start.Column, 0)))
+		} else if lineNum == sr.End.Line {
+			marks.WriteString(strings.Repeat("~", sr.End.Column))
+		} else if lineNum > sr.Start.Line && lineNum < sr.End.Line {
+			marks.WriteString(strings.Repeat("~", 80))
+		}
+	} else {
+		marks.WriteString(strings.Repeat(" ", sr.Start.Column-1))
+		if sr.IsSingleChar() {
+			marks.WriteString("^")
+		} else {
+			marks.WriteString(strings.Repeat("~", sr.Length()))
+		}
+	}
+
+	row := underlineRow{color: color, marks: marks.String()}
+	if lineNum == sr.End.Line {
+		row.label = sr.Label
+		row.attached = sr.IsSingleChar()
+	}
+	return row
+}
+
+// Returns marks with the carets or tildes of a single-line spot written over it.
+func overlayMarks(marks string, spot SourceRange) string {
+	spot = spot.Normalize()
+	if spot.IsMultiline() || spot.Start.Column < 1 {
+		return marks
+	}
+
+	spotMarks := underlineFor(spot, spot.Start.Line, "").marks
+	out := []rune(marks)
+	for len(out) < len([]rune(spotMarks)) {
+		out = append(out, ' ')
+	}
+	for i, m := range []rune(spotMarks) {
+		if m != ' ' {
+			out[i] = m
+		}
+	}
+	return string(out)
+}
+
+// Prints the part of an underline row that falls under one fragment of a wrapped line.
+// The last fragment takes any marks past the end of the line. The label is printed
+// after the fragment holding the last mark, truncated so that the whole row fits
+// within the terminal width.
+func (r *renderer) printUnderlineRow(row underlineRow, fragment, fragments int) {
+	marks := []rune(row.marks)
+	lastMark := len([]rune(strings.TrimRight(row.marks, " "))) - 1
+
+	from, to := 0, len(marks)
+	if fragments > 1 {
+		width := r.e.WrapWidth
+		from = min(fragment*width, len(marks))
+		if fragment < fragments-1 {
+			to = min(from+width, len(marks))
+		}
+		if strings.TrimSpace(string(marks[from:to])) == "" {
+			return
+		}
+	}
+	shown := strings.TrimRight(string(marks[from:to]), " ")
+
+	fmt.Fprint(r.w, "  ", row.color)
+	fmt.Fprint(r.w, strings.Repeat(" ", lineNumWidth+1))
+	fmt.Fprint(r.w, "  ")
+	fmt.Fprint(r.w, shown)
+
+	if row.label != "" && lastMark >= from && lastMark < to {
+		sep := " "
+		if row.attached {
+			sep = "-- "
+		}
+		used := utf8.RuneCountInString(r.e.IndentPrefix) + 2 + lineNumWidth + 1 + 2 + utf8.RuneCountInString(shown) + len(sep)
+		if label := truncate(row.label, r.e.termWidth()-used); label != "" {
+			fmt.Fprint(r.w, sep, label)
+		}
+	}
+
+	fmt.Fprintln(r.w, r.style(colorReset))
+}
+
+// Shortens s to at most width runes, marking the cut with an ellipsis.
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
 }
 
 // Convenience function to create a diagnostic with single-character location information.
@@ -1,9 +1,22 @@
 package fehler
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func TestPositionCreation(t *testing.T) {
@@ -296,3 +309,3727 @@ func TestEmitSarifOutputsValidJSON(t *testing.T) {
 		t.Error("expected 'E001' in JSON output")
 	}
 }
+
+func TestFormatAsEachFormat(t *testing.T) {
+	reporter := NewErrorReporter()
+	reporter.AddSource("main.go", "package main\n\nfunc main() {\n    x := 1\n}\n")
+
+	diag := NewDiagnostic(SeverityError, "unused variable").
+		WithLocation("main.go", 4, 5).
+		WithCode("E002")
+	ds := []*Diagnostic{diag}
+
+	fehlerOut, err := reporter.FormatAs(FormatFehler, ds)
+	if err != nil {
+		t.Fatalf("FormatAs(FormatFehler) failed: %v", err)
+	}
+	if !strings.Contains(fehlerOut, "[E002]") || !strings.Contains(fehlerOut, "x := 1") {
+		t.Errorf("unexpected fehler output: %q", fehlerOut)
+	}
+
+	gccOut, err := reporter.FormatAs(FormatGCC, ds)
+	if err != nil {
+		t.Fatalf("FormatAs(FormatGCC) failed: %v", err)
+	}
+	if !strings.Contains(gccOut, "main.go:4:5: ") {
+		t.Errorf("unexpected gcc output: %q", gccOut)
+	}
+
+	msvcOut, err := reporter.FormatAs(FormatMSVC, ds)
+	if err != nil {
+		t.Fatalf("FormatAs(FormatMSVC) failed: %v", err)
+	}
+	if msvcOut != "main.go(4, 5): error E002: unused variable\n" {
+		t.Errorf("unexpected msvc output: %q", msvcOut)
+	}
+
+	if reporter.Format != FormatFehler {
+		t.Errorf("expected reporter format to stay FormatFehler, got %v", reporter.Format)
+	}
+}
+
+func TestFormatAsUnknownFormat(t *testing.T) {
+	reporter := NewErrorReporter()
+	if _, err := reporter.FormatAs(OutputFormat(42), nil); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat for unknown format, got %v", err)
+	}
+}
+
+func TestNoColorDefaultFromEnvironment(t *testing.T) {
+	previous := noColorDefault
+	t.Cleanup(func() { SetNoColorDefault(previous) })
+	t.Setenv("NO_COLOR", "1")
+	SetNoColorDefault(os.Getenv("NO_COLOR") != "")
+
+	reporter := NewErrorReporter()
+	if !reporter.NoColor {
+		t.Fatal("expected NoColor to be set from NO_COLOR")
+	}
+
+	reporter.AddSource("main.go", "package main\n\nfunc main() {}\n")
+	diag := NewDiagnostic(SeverityWarning, "empty function").
+		WithLocation("main.go", 3, 6).
+		WithHelp("add a body")
+
+	for _, format := range []OutputFormat{FormatFehler, FormatGCC, FormatMSVC} {
+		out, err := reporter.FormatAs(format, []*Diagnostic{diag})
+		if err != nil {
+			t.Fatalf("FormatAs failed: %v", err)
+		}
+		if strings.Contains(out, "\x1b[") {
+			t.Errorf("expected no ANSI codes in format %d, got %q", format, out)
+		}
+	}
+}
+
+func TestReportGroupedSameLine(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.AddSource("calc.go", "package calc\n\nvar total = a + b + c\n")
+
+	reporter.ReportGrouped([]*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "undefined: b", "calc.go", 3, 17),
+		NewDiagnosticWithLocation(SeverityError, "undefined: a", "calc.go", 3, 13),
+		NewDiagnosticWithLocation(SeverityWarning, "undefined: c", "calc.go", 3, 21),
+	})
+
+	out := buf.String()
+	if got := strings.Count(out, "var total = a + b + c"); got != 1 {
+		t.Errorf("expected source line printed once, got %d times:\n%s", got, out)
+	}
+	for _, msg := range []string{"undefined: a", "undefined: b", "undefined: c"} {
+		if got := strings.Count(out, msg); got != 2 {
+			t.Errorf("expected %q in header and caret row, got %d occurrences", msg, got)
+		}
+	}
+
+	caretA := strings.Index(out, "^ undefined: a")
+	caretB := strings.Index(out, "^ undefined: b")
+	caretC := strings.Index(out, "^ undefined: c")
+	if caretA < 0 || caretA > caretB || caretB > caretC {
+		t.Errorf("expected carets stacked in column order:\n%s", out)
+	}
+	if !strings.Contains(out, "\n"+strings.Repeat(" ", 21)+"^ undefined: a\n") {
+		t.Errorf("expected caret for 'a' under column 13:\n%s", out)
+	}
+}
+
+func TestReportGroupedSeparateLines(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.AddSource("calc.go", "package calc\n\nvar x = a\nvar y = b\n")
+
+	reporter.ReportGrouped([]*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "undefined: a", "calc.go", 3, 9),
+		NewDiagnosticWithLocation(SeverityError, "undefined: b", "calc.go", 4, 9),
+	})
+
+	out := buf.String()
+	if !strings.Contains(out, "calc.go:3:9") || !strings.Contains(out, "calc.go:4:9") {
+		t.Errorf("expected diagnostics on different lines to be reported separately:\n%s", out)
+	}
+}
+
+func TestReportGroupedSharesReportPath(t *testing.T) {
+	var buf, gcc bytes.Buffer
+	var hooked []string
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).
+		AddFormat(FormatGCC, &gcc).
+		WithMinSeverity(SeverityWarning).
+		WithOnError(func(d *Diagnostic) { hooked = append(hooked, d.Message) })
+	reporter.AddSource("calc.go", "package calc\n\nvar total = a + b\n")
+
+	reporter.ReportGrouped([]*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "undefined: a", "calc.go", 3, 13).
+			WithContextMessage("while checking total"),
+		NewDiagnosticWithLocation(SeverityError, "undefined: b", "calc.go", 3, 17),
+		NewDiagnostic(SeverityNote, "too verbose"),
+	})
+
+	out := buf.String()
+	if !strings.Contains(out, "context: while checking total") {
+		t.Errorf("expected context message in grouped output:\n%s", out)
+	}
+	if !strings.Contains(out, "1 note hidden") {
+		t.Errorf("expected hidden count in grouped output:\n%s", out)
+	}
+	if !strings.Contains(gcc.String(), "calc.go:3:13: error: undefined: a") ||
+		!strings.Contains(gcc.String(), "calc.go:3:17: error: undefined: b") {
+		t.Errorf("expected grouped diagnostics in extra output:\n%s", gcc.String())
+	}
+	if len(hooked) != 2 {
+		t.Errorf("expected OnError for both errors, got %v", hooked)
+	}
+}
+
+func TestReportAndAbort(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+
+	var codes []int
+	reporter.abortFn = func(code int) {
+		codes = append(codes, code)
+	}
+
+	reporter.ReportAndAbort(NewDiagnostic(SeverityFatal, "cannot open input"))
+
+	if len(codes) != 1 || codes[0] != 1 {
+		t.Errorf("expected abort called once with code 1, got %v", codes)
+	}
+	if !strings.Contains(buf.String(), "fatal: cannot open input") {
+		t.Errorf("expected diagnostic to be reported before abort, got %q", buf.String())
+	}
+}
+
+func TestReportfAndAbort(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+
+	calls := 0
+	reporter.abortFn = func(code int) {
+		calls++
+		if code != 1 {
+			t.Errorf("expected exit code 1, got %d", code)
+		}
+	}
+
+	reporter.ReportfAndAbort(SeverityError, "missing file %q", "main.go")
+
+	if calls != 1 {
+		t.Errorf("expected abort called once, got %d", calls)
+	}
+	if !strings.Contains(buf.String(), `error: missing file "main.go"`) {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
+func TestNormalizeReversedSingleLine(t *testing.T) {
+	r := NewSourceRangeSpan("test.go", 3, 15, 3, 5).Normalize()
+
+	if r.Start.Line != 3 || r.Start.Column != 5 {
+		t.Errorf("unexpected start position %v", r.Start)
+	}
+	if r.End.Line != 3 || r.End.Column != 15 {
+		t.Errorf("unexpected end position %v", r.End)
+	}
+	if got := r.Length(); got != 11 {
+		t.Errorf("expected length 11, got %d", got)
+	}
+}
+
+func TestNormalizeReversedMultiline(t *testing.T) {
+	r := NewSourceRangeSpan("test.go", 8, 2, 5, 10).Normalize()
+
+	if r.Start.Line != 5 || r.Start.Column != 10 {
+		t.Errorf("unexpected start position %v", r.Start)
+	}
+	if r.End.Line != 8 || r.End.Column != 2 {
+		t.Errorf("unexpected end position %v", r.End)
+	}
+	if r.File != "test.go" {
+		t.Errorf("expected file test.go, got %s", r.File)
+	}
+}
+
+func TestNormalizeOrderedRangeUnchanged(t *testing.T) {
+	r := NewSourceRangeSpan("test.go", 5, 10, 8, 2)
+	if got := r.Normalize(); got != r {
+		t.Errorf("expected range unchanged, got %v", got)
+	}
+}
+
+func TestReportReversedRange(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("main.go", "package main\n\nvar answer = 42\n")
+
+	diag := NewDiagnosticWithRange(SeverityError, "bad name", "main.go", 3, 10, 3, 5)
+	out, err := reporter.FormatAs(FormatFehler, []*Diagnostic{diag})
+	if err != nil {
+		t.Fatalf("FormatAs failed: %v", err)
+	}
+	if !strings.Contains(out, "main.go:3:5") {
+		t.Errorf("expected header from normalized start, got %q", out)
+	}
+	if !strings.Contains(out, "    ~~~~~~\n") {
+		t.Errorf("expected underline of length 6, got %q", out)
+	}
+}
+
+func TestRangeWithLabel(t *testing.T) {
+	r := NewSourceRangeSpan("main.go", 3, 5, 3, 9).WithLabel("expected int")
+	if r.Label != "expected int" {
+		t.Errorf("expected label 'expected int', got %q", r.Label)
+	}
+	if r.Start.Column != 5 || r.End.Column != 9 {
+		t.Errorf("expected positions to be kept, got %v", r)
+	}
+}
+
+func TestLabelRenderedAfterUnderline(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("main.go", "package main\n\nvar x int = \"hi\"\n")
+
+	diag := NewDiagnostic(SeverityError, "mismatched types").
+		WithRange(NewSourceRangeSpan("main.go", 3, 13, 3, 16).WithLabel("this is a string"))
+
+	out, err := reporter.FormatAs(FormatFehler, []*Diagnostic{diag})
+	if err != nil {
+		t.Fatalf("FormatAs failed: %v", err)
+	}
+
+	var underline string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, "~~~~") {
+			underline = line
+		}
+	}
+	if !strings.HasSuffix(underline, "~~~~ this is a string") {
+		t.Errorf("expected label on the underline row, got %q", underline)
+	}
+}
+
+func TestLabelTruncatedToTermWidth(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithTermWidth(34)
+	reporter.AddSource("main.go", "package main\n\nvar x int = \"hi\"\n")
+
+	diag := NewDiagnostic(SeverityError, "mismatched types").
+		WithRange(NewSourceRangeSpan("main.go", 3, 13, 3, 16).WithLabel("this label is far too long to fit"))
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{diag})
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, "~~~~") {
+			if got := utf8.RuneCountInString(line); got > 34 {
+				t.Errorf("expected underline row within 34 columns, got %d: %q", got, line)
+			}
+			if !strings.Contains(line, "~~~~ this") || !strings.HasSuffix(line, "…") {
+				t.Errorf("expected truncated label, got %q", line)
+			}
+		}
+	}
+}
+
+func TestUnknownPositionRendering(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("config.toml", "name = 1\nvalue = 2\n")
+
+	diag := NewDiagnostic(SeverityError, "invalid configuration").
+		WithLocation("config.toml", 0, 0).
+		WithHelp("check the file format").
+		WithCode("E100")
+	ds := []*Diagnostic{diag}
+
+	if diag.Range.HasPosition() {
+		t.Error("expected zero position to be unknown")
+	}
+
+	out, err := reporter.FormatAs(FormatFehler, ds)
+	if err != nil {
+		t.Fatalf("FormatAs failed: %v", err)
+	}
+	expected := "error[E100]: invalid configuration\n  config.toml\n  help: check the file format\n\n"
+	if out != expected {
+		t.Errorf("unexpected fehler output:\n%q\nexpected:\n%q", out, expected)
+	}
+
+	out, _ = reporter.FormatAs(FormatGCC, ds)
+	if out != "config.toml: error: invalid configuration\n" {
+		t.Errorf("unexpected gcc output %q", out)
+	}
+
+	out, _ = reporter.FormatAs(FormatMSVC, ds)
+	if out != "config.toml: error E100: invalid configuration\n" {
+		t.Errorf("unexpected msvc output %q", out)
+	}
+}
+
+func TestUnknownColumnSkipsSnippet(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("main.go", "package main\n")
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityWarning, "something odd", "main.go", 1, 0),
+	})
+	if strings.Contains(out, "package main") {
+		t.Errorf("expected no snippet for unknown column, got %q", out)
+	}
+}
+
+func TestCountBySeverity(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(io.Discard)
+
+	severities := []Severity{
+		SeverityFatal,
+		SeverityError,
+		SeverityWarning,
+		SeverityNote,
+		SeverityTodo,
+		SeverityUnimplemented,
+	}
+	for _, sev := range severities {
+		reporter.Report(NewDiagnostic(sev, "first"))
+		reporter.Report(NewDiagnostic(sev, "second"))
+	}
+
+	counts := reporter.CountBySeverity()
+	for _, sev := range severities {
+		if counts[sev] != 2 {
+			t.Errorf("expected 2 %s diagnostics, got %d", sev.Label(), counts[sev])
+		}
+	}
+	if got := reporter.TotalDiagnosticCount(); got != 12 {
+		t.Errorf("expected 12 diagnostics in total, got %d", got)
+	}
+}
+
+func TestCountBySeverityConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithFormat(FormatGCC)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				reporter.Report(NewDiagnostic(SeverityWarning, "concurrent"))
+				_ = reporter.CountBySeverity()
+				_ = reporter.TotalDiagnosticCount()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := reporter.CountBySeverity()[SeverityWarning]; got != 80 {
+		t.Errorf("expected 80 warnings, got %d", got)
+	}
+	if got := strings.Count(buf.String(), "warning: concurrent\n"); got != 80 {
+		t.Errorf("expected 80 intact output lines, got %d", got)
+	}
+}
+
+type failingWriter struct {
+	limit   int
+	written int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.written+len(p) > f.limit {
+		n := f.limit - f.written
+		f.written = f.limit
+		return n, errors.New("disk full")
+	}
+	f.written += len(p)
+	return len(p), nil
+}
+
+func TestWriteTo(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithFormat(FormatMSVC)
+	ds := []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "first", "main.go", 1, 1),
+		NewDiagnosticWithLocation(SeverityWarning, "second", "main.go", 2, 1),
+	}
+
+	var buf bytes.Buffer
+	n, err := reporter.WriteTo(&buf, ds)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("expected %d bytes written, got %d", buf.Len(), n)
+	}
+	expected := "main.go(1, 1): error unknown: first\nmain.go(2, 1): warning unknown: second\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
+func TestWriteToPropagatesError(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithFormat(FormatMSVC)
+	ds := []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "first", "main.go", 1, 1),
+		NewDiagnosticWithLocation(SeverityError, "second", "main.go", 2, 1),
+		NewDiagnosticWithLocation(SeverityError, "third", "main.go", 3, 1),
+	}
+
+	w := &failingWriter{limit: 50}
+	n, err := reporter.WriteTo(w, ds)
+	if err == nil || err.Error() != "disk full" {
+		t.Fatalf("expected 'disk full' error, got %v", err)
+	}
+	if n != 50 {
+		t.Errorf("expected 50 bytes written before failure, got %d", n)
+	}
+	if got := reporter.TotalDiagnosticCount(); got != 2 {
+		t.Errorf("expected reporting to stop after the failed write, got %d reported", got)
+	}
+}
+
+func TestAnnotatedError(t *testing.T) {
+	_, err := strconv.Atoi("12x")
+	r := NewSourceRangeSpan("config.txt", 4, 9, 4, 11)
+	annotated := AnnotateHint(err, r, "use only digits")
+
+	if !errors.Is(annotated, strconv.ErrSyntax) {
+		t.Error("expected annotated error to unwrap to strconv.ErrSyntax")
+	}
+	if !strings.HasPrefix(annotated.Error(), "config.txt:4:9: ") {
+		t.Errorf("expected location prefix, got %q", annotated.Error())
+	}
+
+	diag := annotated.Diagnostic()
+	if diag.Severity != SeverityError {
+		t.Errorf("expected SeverityError, got %v", diag.Severity)
+	}
+	if diag.Message != err.Error() {
+		t.Errorf("expected message %q, got %q", err.Error(), diag.Message)
+	}
+	if diag.Range == nil || *diag.Range != r {
+		t.Errorf("expected range %v, got %v", r, diag.Range)
+	}
+	if diag.Help == nil || *diag.Help != "use only digits" {
+		t.Errorf("expected help from hint, got %v", diag.Help)
+	}
+}
+
+func TestAnnotateWithoutHint(t *testing.T) {
+	diag := Annotate(strconv.ErrSyntax, NewSourceRangeSingle("a.txt", 1, 1)).Diagnostic()
+	if diag.Help != nil {
+		t.Errorf("expected no help, got %q", *diag.Help)
+	}
+	if diag.Message != "invalid syntax" {
+		t.Errorf("expected message 'invalid syntax', got %q", diag.Message)
+	}
+}
+
+func TestStopOnFatal(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithStopOnFatal(true)
+
+	result := reporter.ReportManyWithResult([]*Diagnostic{
+		NewDiagnostic(SeverityError, "before fatal"),
+		NewDiagnostic(SeverityFatal, "cannot continue"),
+		NewDiagnostic(SeverityError, "after fatal"),
+	})
+
+	if !result.Stopped {
+		t.Error("expected ReportManyWithResult to report that it stopped")
+	}
+	out := buf.String()
+	if !strings.Contains(out, "before fatal") || !strings.Contains(out, "fatal: cannot continue") {
+		t.Errorf("expected diagnostics up to and including the fatal, got %q", out)
+	}
+	if strings.Contains(out, "after fatal") {
+		t.Errorf("expected diagnostics after the fatal to be skipped, got %q", out)
+	}
+}
+
+func TestFatalWithoutStopOnFatal(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+
+	result := reporter.ReportManyWithResult([]*Diagnostic{
+		NewDiagnostic(SeverityFatal, "cannot continue"),
+		NewDiagnostic(SeverityError, "after fatal"),
+	})
+
+	if result.Stopped {
+		t.Error("expected ReportManyWithResult not to stop")
+	}
+	if !strings.Contains(buf.String(), "after fatal") {
+		t.Errorf("expected all diagnostics to be reported, got %q", buf.String())
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	reporter := NewErrorReporter()
+	r := NewSourceRangeSpan("parser.go", 12, 4, 12, 9)
+
+	diag := reporter.WrapError(errors.New("unexpected token"), SeverityError, r)
+
+	if diag.Message != "unexpected token" {
+		t.Errorf("expected message 'unexpected token', got %q", diag.Message)
+	}
+	if diag.Severity != SeverityError {
+		t.Errorf("expected SeverityError, got %v", diag.Severity)
+	}
+	if diag.Range == nil || *diag.Range != r {
+		t.Errorf("expected range %v, got %v", r, diag.Range)
+	}
+
+	collected := reporter.Collected()
+	if len(collected) != 1 || collected[0] != diag {
+		t.Errorf("expected wrapped diagnostic to be collected, got %v", collected)
+	}
+}
+
+func TestDisabledSeverities(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().
+		WithNoColor(true).
+		WithWriter(&buf).
+		WithDisabledSeverities(SeverityTodo)
+
+	reporter.ReportMany([]*Diagnostic{
+		NewDiagnostic(SeverityError, "broken"),
+		NewDiagnostic(SeverityTodo, "finish this"),
+		NewDiagnostic(SeverityNote, "for reference"),
+	})
+
+	out := buf.String()
+	if strings.Contains(out, "finish this") {
+		t.Errorf("expected todo to be hidden, got %q", out)
+	}
+	if !strings.Contains(out, "note: for reference") || !strings.Contains(out, "error: broken") {
+		t.Errorf("expected note and error to be shown, got %q", out)
+	}
+
+	counts := reporter.CountBySeverity()
+	if counts[SeverityTodo] != 0 {
+		t.Errorf("expected disabled todo not to be counted, got %d", counts[SeverityTodo])
+	}
+	if counts[SeverityNote] != 1 || counts[SeverityError] != 1 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+func TestDiagnosticWithArgs(t *testing.T) {
+	diag := NewDiagnostic(SeverityError, "expected %d arguments, got %d").WithArgs(2, 3)
+
+	if diag.Message != "expected %d arguments, got %d" {
+		t.Errorf("expected raw format string to be kept, got %q", diag.Message)
+	}
+	if got := diag.ResolvedMessage(); got != "expected 2 arguments, got 3" {
+		t.Errorf("unexpected resolved message %q", got)
+	}
+
+	reporter := NewErrorReporter().WithNoColor(true)
+	out, _ := reporter.FormatAs(FormatGCC, []*Diagnostic{diag})
+	if out != "error: expected 2 arguments, got 3\n" {
+		t.Errorf("expected resolved message in output, got %q", out)
+	}
+}
+
+func TestResolvedMessageWithoutArgs(t *testing.T) {
+	diag := NewDiagnostic(SeverityWarning, "100% done")
+	if got := diag.ResolvedMessage(); got != "100% done" {
+		t.Errorf("expected message without args to be untouched, got %q", got)
+	}
+}
+
+func TestPositionString(t *testing.T) {
+	if got := (Position{Line: 3, Column: 14}).String(); got != "3:14" {
+		t.Errorf("expected '3:14', got %q", got)
+	}
+}
+
+func TestSourceRangeString(t *testing.T) {
+	tests := []struct {
+		r        SourceRange
+		expected string
+	}{
+		{NewSourceRangeSingle("main.go", 4, 2), "main.go:4:2"},
+		{NewSourceRangeSpan("main.go", 4, 2, 4, 9), "main.go:4:2-4:9"},
+		{NewSourceRangeSpan("main.go", 4, 2, 7, 1), "main.go:4:2-7:1"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.r.String(); got != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, got)
+		}
+		if got := fmt.Sprintf("%v", tt.r); got != tt.expected {
+			t.Errorf("expected %%v to use String, got %q", got)
+		}
+	}
+}
+
+func numberedSource(n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "line %d\n", i)
+	}
+	return sb.String()
+}
+
+func TestSnippetEllipsis(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("big.txt", numberedSource(100))
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "bad line", "big.txt", 50, 1),
+	})
+
+	expected := "" +
+		"  ...\n" +
+		"    48 | line 48\n" +
+		"    49 | line 49\n" +
+		"    50 | line 50\n" +
+		"         ^\n" +
+		"    51 | line 51\n" +
+		"    52 | line 52\n" +
+		"  ...\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected ellipsis around context, got:\n%s", out)
+	}
+}
+
+func TestSnippetEllipsisAtFileBoundaries(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("small.txt", numberedSource(3))
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "bad line", "small.txt", 2, 1),
+	})
+	if strings.Contains(out, "...") {
+		t.Errorf("expected no ellipsis when the whole file is shown, got:\n%s", out)
+	}
+}
+
+func TestSnippetEllipsisDisabled(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithShowEllipsis(false)
+	reporter.AddSource("big.txt", numberedSource(100))
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "bad line", "big.txt", 50, 1),
+	})
+	if strings.Contains(out, "...") {
+		t.Errorf("expected no ellipsis when disabled, got:\n%s", out)
+	}
+}
+
+func TestFilterAgainstBaseline(t *testing.T) {
+	baseline := []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityWarning, "unused variable", "main.go", 4, 2).WithCode("W001"),
+		NewDiagnosticWithLocation(SeverityError, "missing return", "util.go", 10, 1).WithCode("E002"),
+	}
+
+	existing := NewDiagnosticWithLocation(SeverityWarning, "unused variable", "main.go", 4, 2).WithCode("W001")
+	shifted := NewDiagnosticWithLocation(SeverityError, "missing return", "util.go", 14, 1).WithCode("E002")
+	fresh := NewDiagnosticWithLocation(SeverityWarning, "unused import", "main.go", 2, 8).WithCode("W002")
+
+	got := FilterAgainstBaseline([]*Diagnostic{existing, shifted, fresh}, baseline)
+	if len(got) != 1 || got[0] != fresh {
+		t.Errorf("expected only the new diagnostic, got %v", got)
+	}
+}
+
+func TestFilterAgainstBaselineKeepsExtraOccurrences(t *testing.T) {
+	baseline := []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityWarning, "unused variable", "main.go", 4, 2),
+	}
+
+	first := NewDiagnosticWithLocation(SeverityWarning, "unused variable", "main.go", 9, 2)
+	second := NewDiagnosticWithLocation(SeverityWarning, "unused variable", "main.go", 4, 2)
+
+	got := FilterAgainstBaseline([]*Diagnostic{first, second}, baseline)
+	if len(got) != 1 || got[0] != first {
+		t.Errorf("expected the exact match to be removed and the extra one kept, got %v", got)
+	}
+}
+
+func TestSuppressedDiagnostics(t *testing.T) {
+	ds := func() []*Diagnostic {
+		return []*Diagnostic{
+			NewDiagnostic(SeverityError, "first problem"),
+			NewDiagnostic(SeverityWarning, "known issue").Suppress(),
+			NewDiagnostic(SeverityError, "second problem"),
+		}
+	}
+
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.ReportMany(ds())
+
+	out := buf.String()
+	if !strings.Contains(out, "error: first problem") || !strings.Contains(out, "error: second problem") {
+		t.Errorf("expected non-suppressed diagnostics to print, got %q", out)
+	}
+	if strings.Contains(out, "known issue") {
+		t.Errorf("expected suppressed diagnostic to be skipped, got %q", out)
+	}
+	if got := reporter.SuppressedCount(); got != 1 {
+		t.Errorf("expected 1 suppressed diagnostic, got %d", got)
+	}
+	if got := reporter.TotalDiagnosticCount(); got != 2 {
+		t.Errorf("expected 2 counted diagnostics, got %d", got)
+	}
+
+	buf.Reset()
+	shown := NewErrorReporter().WithNoColor(false).WithWriter(&buf).WithShowSuppressed()
+	shown.ReportMany(ds())
+
+	out = buf.String()
+	if !strings.Contains(out, colorDim+colorBold+"warning"+colorReset+": known issue (suppressed)") {
+		t.Errorf("expected suppressed diagnostic dimmed with suffix, got %q", out)
+	}
+	if got := shown.SuppressedCount(); got != 1 {
+		t.Errorf("expected 1 suppressed diagnostic, got %d", got)
+	}
+}
+
+func TestApplySuggestions(t *testing.T) {
+	sources := map[string]string{
+		"main.go": "package main\n\nvar x = fmt.Sprint(y)\n",
+		"util.go": "package main\n\nfunc hlper() {}\n",
+	}
+
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityError, "undefined: y").
+			WithLocation("main.go", 3, 20).
+			WithSuggestion(NewSourceRangeSingle("main.go", 3, 20), "x0"),
+		NewDiagnostic(SeverityWarning, "prefer Sprintf").
+			WithSuggestion(NewSourceRangeSpan("main.go", 3, 13, 3, 18), "Sprintf"),
+		NewDiagnostic(SeverityWarning, "typo in name").
+			WithSuggestion(NewSourceRangeSpan("util.go", 3, 6, 3, 10), "helper"),
+	}
+
+	updated, applied, err := ApplySuggestions(sources, ds)
+	if err != nil {
+		t.Fatalf("ApplySuggestions failed: %v", err)
+	}
+	if applied != 3 {
+		t.Errorf("expected 3 fixes applied, got %d", applied)
+	}
+	if got := updated["main.go"]; got != "package main\n\nvar x = fmt.Sprintf(x0)\n" {
+		t.Errorf("unexpected main.go %q", got)
+	}
+	if got := updated["util.go"]; got != "package main\n\nfunc helper() {}\n" {
+		t.Errorf("unexpected util.go %q", got)
+	}
+	if sources["main.go"] != "package main\n\nvar x = fmt.Sprint(y)\n" {
+		t.Error("expected input sources to be left untouched")
+	}
+}
+
+func TestApplySuggestionsSkipsOverlaps(t *testing.T) {
+	sources := map[string]string{"a.txt": "hello world\n"}
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityNote, "first").WithSuggestion(NewSourceRangeSpan("a.txt", 1, 1, 1, 5), "howdy"),
+		NewDiagnostic(SeverityNote, "second").WithSuggestion(NewSourceRangeSpan("a.txt", 1, 3, 1, 8), "xx"),
+	}
+
+	updated, applied, err := ApplySuggestions(sources, ds)
+	if err != nil {
+		t.Fatalf("ApplySuggestions failed: %v", err)
+	}
+	if applied != 1 || updated["a.txt"] != "howdy world\n" {
+		t.Errorf("expected only the first fix applied, got %d: %q", applied, updated["a.txt"])
+	}
+}
+
+func TestApplySuggestionsMissingSource(t *testing.T) {
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityNote, "fix").WithSuggestion(NewSourceRangeSingle("missing.go", 1, 1), "x"),
+	}
+	if _, _, err := ApplySuggestions(map[string]string{}, ds); err == nil {
+		t.Error("expected error for unregistered file")
+	}
+}
+
+func TestSyntaxHighlighting(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(false).WithSyntaxHighlighting(true)
+	reporter.AddSourceWithLanguage("main.go", "package main\n\nfunc main() {\n\tvar functional = 1\n}\n", "go")
+
+	diag := NewDiagnosticWithLocation(SeverityError, "unused variable", "main.go", 4, 6)
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{diag})
+
+	if !strings.Contains(out, colorBold+"func"+colorReset+" main() {") {
+		t.Errorf("expected 'func' keyword in bold, got %q", out)
+	}
+	if !strings.Contains(out, colorBold+"var"+colorReset+" functional") {
+		t.Errorf("expected 'var' keyword in bold and identifiers untouched, got %q", out)
+	}
+}
+
+func TestSyntaxHighlightingOff(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(false)
+	reporter.AddSourceWithLanguage("main.go", "package main\n\nfunc main() {}\n", "go")
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "empty", "main.go", 3, 1),
+	})
+	if strings.Contains(out, colorBold+"func"+colorReset) {
+		t.Errorf("expected no highlighting unless enabled, got %q", out)
+	}
+}
+
+func TestWithPrimaryDrivesHeader(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("decl.go", "package main\n\nvar count int\n")
+	reporter.AddSource("use.go", "package main\n\nvar total = count + \"x\"\n")
+
+	decl := NewSourceRangeSpan("decl.go", 3, 5, 3, 9).WithLabel("declared here")
+	use := NewSourceRangeSpan("use.go", 3, 13, 3, 23).WithLabel("used here")
+
+	diag := NewDiagnostic(SeverityError, "mismatched types").
+		WithRange(decl).
+		WithSecondaryRange(use).
+		WithPrimary(use)
+
+	if diag.Range == nil || *diag.Range != use {
+		t.Fatalf("expected primary range %v, got %v", use, diag.Range)
+	}
+	if len(diag.SecondaryRanges) != 1 || diag.SecondaryRanges[0] != decl {
+		t.Fatalf("expected old primary to become secondary, got %v", diag.SecondaryRanges)
+	}
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{diag})
+	lines := strings.Split(out, "\n")
+	if len(lines) < 2 || lines[1] != "  use.go:3:13" {
+		t.Errorf("expected header to follow the primary range, got:\n%s", out)
+	}
+	usePos := strings.Index(out, "used here")
+	declPos := strings.Index(out, "declared here")
+	if usePos < 0 || declPos < 0 || usePos > declPos {
+		t.Errorf("expected primary snippet before secondary snippet, got:\n%s", out)
+	}
+
+	gcc, _ := reporter.FormatAs(FormatGCC, []*Diagnostic{diag})
+	if !strings.HasPrefix(gcc, "use.go:3:13: ") {
+		t.Errorf("expected gcc location from the primary range, got %q", gcc)
+	}
+}
+
+func TestSecondaryRangeColor(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(false)
+	reporter.AddSource("main.go", "package main\n\nvar a, b = 1, 2\n")
+
+	diag := NewDiagnostic(SeverityWarning, "shadowed").
+		WithRange(NewSourceRangeSingle("main.go", 3, 5)).
+		WithSecondaryRange(NewSourceRangeSingle("main.go", 3, 8).WithLabel("first"))
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{diag})
+	if !strings.Contains(out, colorDim+colorCyan+strings.Repeat(" ", 5)+"  "+strings.Repeat(" ", 7)+"^-- first") {
+		t.Errorf("expected secondary underline and label in dim cyan, got %q", out)
+	}
+}
+
+func TestWithNotes(t *testing.T) {
+	diag := NewDiagnostic(SeverityError, "cannot borrow").WithNotes("first note", "second note")
+
+	if len(diag.Notes) != 2 {
+		t.Fatalf("expected 2 notes, got %d", len(diag.Notes))
+	}
+	for i, msg := range []string{"first note", "second note"} {
+		note := diag.Notes[i]
+		if note.Severity != SeverityNote {
+			t.Errorf("expected SeverityNote, got %v", note.Severity)
+		}
+		if note.Message != msg {
+			t.Errorf("expected message %q, got %q", msg, note.Message)
+		}
+		if note.Range != nil {
+			t.Errorf("expected no range, got %v", note.Range)
+		}
+	}
+}
+
+func TestWithNoteAtRendering(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("main.go", "package main\n\nvar x = 1\nvar x = 2\n")
+
+	diag := NewDiagnosticWithLocation(SeverityError, "x redeclared", "main.go", 4, 5).
+		WithNoteAt("previous declaration", "main.go", 3, 5).
+		WithNote("names must be unique")
+
+	if diag.Notes[0].Range == nil || diag.Notes[0].Range.Start.Line != 3 {
+		t.Fatalf("expected located note, got %v", diag.Notes[0].Range)
+	}
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{diag})
+	if !strings.Contains(out, "  note: previous declaration\n  main.go:3:5\n") {
+		t.Errorf("expected located note with its own snippet, got:\n%s", out)
+	}
+	if !strings.Contains(out, "  note: names must be unique\n") {
+		t.Errorf("expected plain note, got:\n%s", out)
+	}
+}
+
+func TestWrapWidthContinuationGutter(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithWrapWidth(10).WithShowEllipsis(false)
+	reporter.AddSource("long.txt", "short\nabcdefghijKLMNOPQRSTuvwxy\n")
+
+	diag := NewDiagnostic(SeverityError, "bad letters").
+		WithRange(NewSourceRangeSpan("long.txt", 2, 9, 2, 13).WithLabel("here"))
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{diag})
+
+	expected := "" +
+		"     1 | short\n" +
+		"     2 | abcdefghij\n" +
+		"                 ~~\n" +
+		"       | KLMNOPQRST\n" +
+		"         ~~~ here\n" +
+		"       | uvwxy\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected wrapped line with continuation gutter, got:\n%s", out)
+	}
+}
+
+func TestWrapWidthShortLinesUnchanged(t *testing.T) {
+	source := "package main\n\nvar x = 1\n"
+	diag := NewDiagnosticWithLocation(SeverityError, "unused", "main.go", 3, 5)
+
+	plain := NewErrorReporter().WithNoColor(true)
+	plain.AddSource("main.go", source)
+	wrapped := NewErrorReporter().WithNoColor(true).WithWrapWidth(40)
+	wrapped.AddSource("main.go", source)
+
+	a, _ := plain.FormatAs(FormatFehler, []*Diagnostic{diag})
+	b, _ := wrapped.FormatAs(FormatFehler, []*Diagnostic{diag})
+	if a != b {
+		t.Errorf("expected identical output for lines shorter than WrapWidth:\n%s\n%s", a, b)
+	}
+}
+
+func TestEmitSarifSuppression(t *testing.T) {
+	ds := []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityWarning, "known issue", "main.go", 1, 1).Suppress(),
+		NewDiagnosticWithLocation(SeverityWarning, "new issue", "main.go", 2, 1),
+	}
+
+	var buf bytes.Buffer
+	if err := EmitSarif(ds, &buf); err != nil {
+		t.Fatalf("EmitSarif failed: %v", err)
+	}
+
+	var parsed struct {
+		Runs []struct {
+			Results []struct {
+				Suppressions []struct {
+					Kind  string `json:"kind"`
+					State string `json:"state"`
+				} `json:"suppressions"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	results := parsed.Runs[0].Results
+	if len(results[0].Suppressions) != 1 {
+		t.Fatalf("expected one suppression, got %v", results[0].Suppressions)
+	}
+	if s := results[0].Suppressions[0]; s.State != "accepted" || s.Kind != "inSource" {
+		t.Errorf("unexpected suppression %+v", s)
+	}
+	if len(results[1].Suppressions) != 0 {
+		t.Errorf("expected no suppressions on unsuppressed result, got %v", results[1].Suppressions)
+	}
+}
+
+func TestNewSourceRangeLen(t *testing.T) {
+	tests := []struct {
+		length    int
+		endColumn int
+	}{
+		{1, 4},
+		{5, 8},
+		{0, 4},
+	}
+
+	for _, tt := range tests {
+		r := NewSourceRangeLen("lex.go", 7, 4, tt.length)
+		if r.Start.Line != 7 || r.Start.Column != 4 {
+			t.Errorf("length %d: unexpected start %v", tt.length, r.Start)
+		}
+		if r.End.Line != 7 || r.End.Column != tt.endColumn {
+			t.Errorf("length %d: expected end 7:%d, got %v", tt.length, tt.endColumn, r.End)
+		}
+	}
+
+	if !NewSourceRangeLen("lex.go", 1, 1, 1).IsSingleChar() {
+		t.Error("expected length 1 to be a single character")
+	}
+	if got := NewSourceRangeLen("lex.go", 1, 1, 5).Length(); got != 5 {
+		t.Errorf("expected length 5, got %d", got)
+	}
+}
+
+func TestSummaryAfterN(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithFormat(FormatGCC).WithSummaryAfterN(2)
+
+	reporter.ReportMany([]*Diagnostic{
+		NewDiagnostic(SeverityError, "one"),
+		NewDiagnostic(SeverityWarning, "two"),
+		NewDiagnostic(SeverityError, "three"),
+		NewDiagnostic(SeverityFatal, "four"),
+		NewDiagnostic(SeverityNote, "five"),
+	})
+
+	expected := "" +
+		"error: one\n" +
+		"warning: two\n" +
+		"[2 diagnostics so far: 1 errors, 1 warnings]\n" +
+		"error: three\n" +
+		"fatal: four\n" +
+		"[4 diagnostics so far: 3 errors, 1 warnings]\n" +
+		"note: five\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestSummaryAfterNIgnoresSuppressed(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithFormat(FormatGCC).WithSummaryAfterN(2).WithShowSuppressed()
+
+	reporter.ReportMany([]*Diagnostic{
+		NewDiagnostic(SeverityError, "one"),
+		NewDiagnostic(SeverityWarning, "two"),
+		NewDiagnostic(SeverityError, "hidden").Suppress(),
+	})
+
+	if n := strings.Count(buf.String(), "diagnostics so far"); n != 1 {
+		t.Errorf("expected the summary once, got %d times:\n%s", n, buf.String())
+	}
+}
+
+func TestIndentPrefix(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithIndentPrefix("    ")
+	reporter.AddSource("main.go", "package main\n\nvar x = 1\n")
+
+	diag := NewDiagnosticWithRange(SeverityError, "unused variable", "main.go", 3, 5, 3, 5).
+		WithHelp("remove it")
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{diag})
+
+	expected := "" +
+		"    error: unused variable\n" +
+		"      main.go:3:5\n" +
+		"         1 | package main\n" +
+		"         2 | \n" +
+		"         3 | var x = 1\n" +
+		"                 ^\n" +
+		"         4 | \n" +
+		"      help: remove it\n" +
+		"    \n"
+	if out != expected {
+		t.Errorf("unexpected output:\n%q\nexpected:\n%q", out, expected)
+	}
+
+	lines := strings.Split(out, "\n")
+	source, caret := lines[4], lines[5]
+	if strings.Index(source, "x") != strings.Index(caret, "^") {
+		t.Errorf("expected caret under 'x':\n%s\n%s", source, caret)
+	}
+}
+
+func TestIsAdjacentTo(t *testing.T) {
+	foo := NewSourceRangeSpan("main.go", 3, 5, 3, 7)
+
+	tests := []struct {
+		name     string
+		other    SourceRange
+		expected bool
+	}{
+		{"adjacent", NewSourceRangeSingle("main.go", 3, 8), true},
+		{"gap", NewSourceRangeSingle("main.go", 3, 9), false},
+		{"overlapping", NewSourceRangeSingle("main.go", 3, 7), false},
+		{"different line", NewSourceRangeSingle("main.go", 4, 8), false},
+		{"different file", NewSourceRangeSingle("other.go", 3, 8), false},
+	}
+
+	for _, tt := range tests {
+		if got := foo.IsAdjacentTo(tt.other); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+
+	multiline := NewSourceRangeSpan("main.go", 1, 10, 3, 4)
+	if !multiline.IsAdjacentTo(foo) {
+		t.Error("expected multiline range ending at 3:4 to be adjacent to 3:5")
+	}
+	if foo.IsAdjacentTo(NewSourceRangeSingle("main.go", 4, 1)) {
+		t.Error("expected no adjacency across a line break")
+	}
+}
+
+func TestSeverityFromSarifLevel(t *testing.T) {
+	tests := map[string]Severity{
+		"error":   SeverityError,
+		"warning": SeverityWarning,
+		"note":    SeverityNote,
+		"none":    SeverityNote,
+		"":        SeverityWarning,
+		"bogus":   SeverityWarning,
+	}
+	for level, expected := range tests {
+		if got := SeverityFromSarifLevel(level); got != expected {
+			t.Errorf("level %q: expected %v, got %v", level, expected, got)
+		}
+	}
+}
+
+func TestDiagnosticsFromSarifRoundTrip(t *testing.T) {
+	original := []*Diagnostic{
+		NewDiagnosticWithRange(SeverityError, "type mismatch", "main.go", 5, 14, 5, 20).
+			WithCode("E0001").
+			WithUrl("https://docs.example.org/errors/E0001"),
+		NewDiagnosticWithLocation(SeverityWarning, "unused import", "util.go", 2, 8),
+		NewDiagnostic(SeverityNote, "build finished"),
+	}
+
+	var buf bytes.Buffer
+	if err := EmitSarif(original, &buf); err != nil {
+		t.Fatalf("EmitSarif failed: %v", err)
+	}
+	var report SarifReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	restored := DiagnosticsFromSarif(report)
+	if len(restored) != len(original) {
+		t.Fatalf("expected %d diagnostics, got %d", len(original), len(restored))
+	}
+	for i, d := range restored {
+		o := original[i]
+		if d.Severity != o.Severity || d.Message != o.Message {
+			t.Errorf("diagnostic %d: expected %v %q, got %v %q", i, o.Severity, o.Message, d.Severity, d.Message)
+		}
+		if (d.Range == nil) != (o.Range == nil) || d.Range != nil && *d.Range != *o.Range {
+			t.Errorf("diagnostic %d: expected range %v, got %v", i, o.Range, d.Range)
+		}
+	}
+	if restored[0].Code == nil || *restored[0].Code != "E0001" {
+		t.Errorf("expected code E0001, got %v", restored[0].Code)
+	}
+	if restored[0].Url == nil || *restored[0].Url != "https://docs.example.org/errors/E0001" {
+		t.Errorf("expected help URI restored, got %v", restored[0].Url)
+	}
+}
+
+func TestByLocation(t *testing.T) {
+	noRange := NewDiagnostic(SeverityError, "no range")
+	a1 := NewDiagnosticWithLocation(SeverityError, "a1", "a.go", 1, 5)
+	a2 := NewDiagnosticWithLocation(SeverityError, "a2", "a.go", 1, 9)
+	a3 := NewDiagnosticWithLocation(SeverityError, "a3", "a.go", 3, 1)
+	b1 := NewDiagnosticWithLocation(SeverityError, "b1", "b.go", 1, 1)
+	dup := NewDiagnosticWithLocation(SeverityWarning, "dup", "a.go", 1, 5)
+
+	ds := []*Diagnostic{noRange, b1, a3, a2, dup, a1}
+	slices.SortStableFunc(ds, ByLocation)
+
+	var got []string
+	for _, d := range ds {
+		got = append(got, d.Message)
+	}
+	expected := []string{"dup", "a1", "a2", "a3", "b1", "no range"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if ByLocation(a1, dup) != 0 {
+		t.Error("expected diagnostics at the same location to compare equal")
+	}
+	if ByLocation(noRange, NewDiagnostic(SeverityNote, "other")) != 0 {
+		t.Error("expected two rangeless diagnostics to compare equal")
+	}
+}
+
+func TestByCode(t *testing.T) {
+	e2 := NewDiagnostic(SeverityError, "e2").WithCode("E0002")
+	e1 := NewDiagnostic(SeverityError, "e1").WithCode("E0001")
+	dup := NewDiagnostic(SeverityError, "dup").WithCode("E0001")
+	none := NewDiagnostic(SeverityError, "none")
+
+	ds := []*Diagnostic{none, e2, e1, dup}
+	slices.SortStableFunc(ds, ByCode)
+
+	var got []string
+	for _, d := range ds {
+		got = append(got, d.Message)
+	}
+	expected := []string{"e1", "dup", "e2", "none"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestByMessage(t *testing.T) {
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityError, "zeta"),
+		NewDiagnostic(SeverityError, "value %d").WithArgs(2),
+		NewDiagnostic(SeverityError, "alpha"),
+		NewDiagnostic(SeverityError, "alpha"),
+	}
+	slices.SortFunc(ds, ByMessage)
+
+	var got []string
+	for _, d := range ds {
+		got = append(got, d.ResolvedMessage())
+	}
+	expected := []string{"alpha", "alpha", "value 2", "zeta"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestParseSarif(t *testing.T) {
+	sample := `{
+  "version": "2.1.0",
+  "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+  "runs": [{
+    "tool": {"driver": {"name": "other-linter", "version": "1.2.3", "semanticVersion": "1.2.3"}},
+    "invocations": [{"executionSuccessful": true}],
+    "results": [{
+      "ruleId": "L001",
+      "level": "warning",
+      "message": {"text": "line too long"},
+      "locations": [{"physicalLocation": {
+        "artifactLocation": {"uri": "src/lib.go", "uriBaseId": "SRCROOT"},
+        "region": {"startLine": 12, "startColumn": 81, "endLine": 12, "endColumn": 95}
+      }}]
+    }]
+  }]
+}`
+
+	report, err := ParseSarif(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("ParseSarif failed: %v", err)
+	}
+	if report.Version != "2.1.0" || len(report.Runs) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Runs[0].Tool.Driver.Name != "other-linter" {
+		t.Errorf("expected driver name other-linter, got %q", report.Runs[0].Tool.Driver.Name)
+	}
+
+	ds := DiagnosticsFromSarif(report)
+	if len(ds) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d", len(ds))
+	}
+	expected := NewSourceRangeSpan("src/lib.go", 12, 81, 12, 95)
+	if ds[0].Range == nil || *ds[0].Range != expected {
+		t.Errorf("expected range %v, got %v", expected, ds[0].Range)
+	}
+
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithFormat(FormatGCC).WithNoColor(true).WithWriter(&buf)
+	reporter.Report(ds[0])
+	if !strings.Contains(buf.String(), "src/lib.go:12:81: warning: line too long") {
+		t.Errorf("expected re-rendered GCC output, got %q", buf.String())
+	}
+}
+
+func TestParseSarifMalformed(t *testing.T) {
+	_, err := ParseSarif(strings.NewReader(`{"version": "2.1.0", "runs": [`))
+	if err == nil {
+		t.Fatal("expected error for malformed SARIF")
+	}
+	if !strings.Contains(err.Error(), "parse sarif") {
+		t.Errorf("expected wrapped parse error, got %v", err)
+	}
+}
+
+func TestAddSourceURI(t *testing.T) {
+	const uri = "https://example.com/main.go"
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.AddSourceURI(uri, "package main\n\nfunc main() {\n\tundefinedCall()\n}\n")
+
+	reporter.Report(NewDiagnostic(SeverityError, "undefined: undefinedCall").
+		WithRange(NewSourceRangeSpan(uri, 4, 2, 4, 14)))
+
+	out := buf.String()
+	if !strings.Contains(out, uri+":4:2") {
+		t.Errorf("expected location with URI, got %q", out)
+	}
+	if !strings.Contains(out, "   4 | \tundefinedCall()") {
+		t.Errorf("expected snippet from URI source, got %q", out)
+	}
+	if strings.Contains(out, "see: "+uri) {
+		t.Errorf("did not expect see line when source is registered, got %q", out)
+	}
+}
+
+func TestRemoteURIWithoutSource(t *testing.T) {
+	const uri = "http://example.com/remote.go"
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.Report(NewDiagnosticWithLocation(SeverityWarning, "unused variable", uri, 3, 5))
+
+	out := buf.String()
+	if !strings.Contains(out, "  see: "+uri+"\n") {
+		t.Errorf("expected see line for unregistered URI, got %q", out)
+	}
+	if strings.Contains(out, " | ") {
+		t.Errorf("did not expect a snippet, got %q", out)
+	}
+}
+
+func TestShowOffset(t *testing.T) {
+	source := "package main\n\nfunc main() {\n\tx := \"héllo\" + 1\n}\n"
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithShowOffset(true)
+	reporter.AddSource("main.go", source)
+
+	// Column 15 on line 4 is the "+", after a multi-byte rune.
+	reporter.Report(NewDiagnosticWithLocation(SeverityError, "mismatched types", "main.go", 4, 15))
+
+	expected := strings.Index(source, "+")
+	if !strings.Contains(buf.String(), fmt.Sprintf("  main.go:4:15 (offset %d)\n", expected)) {
+		t.Errorf("expected offset %d in location line, got %q", expected, buf.String())
+	}
+}
+
+func TestShowOffsetWithoutSource(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithShowOffset(true)
+	reporter.Report(NewDiagnosticWithLocation(SeverityError, "oops", "missing.go", 1, 1))
+
+	if strings.Contains(buf.String(), "offset") {
+		t.Errorf("did not expect offset without a registered source, got %q", buf.String())
+	}
+}
+
+func TestSarifCodeFlow(t *testing.T) {
+	steps := []SourceRange{
+		NewSourceRangeSpan("handler.go", 10, 9, 10, 28),
+		NewSourceRangeSpan("handler.go", 14, 2, 14, 20),
+		NewSourceRangeSpan("db.go", 31, 15, 31, 40),
+	}
+	d := NewDiagnosticWithRange(SeverityError, "untrusted input reaches SQL query", "db.go", 31, 15, 31, 40).
+		WithCode("TAINT001").
+		WithCodeFlow(steps)
+
+	var buf bytes.Buffer
+	if err := EmitSarif([]*Diagnostic{d}, &buf); err != nil {
+		t.Fatalf("EmitSarif failed: %v", err)
+	}
+
+	var raw struct {
+		Runs []struct {
+			Results []struct {
+				CodeFlows []struct {
+					ThreadFlows []struct {
+						Locations []struct {
+							Location SarifLocation `json:"location"`
+						} `json:"locations"`
+					} `json:"threadFlows"`
+				} `json:"codeFlows"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	flows := raw.Runs[0].Results[0].CodeFlows
+	if len(flows) != 1 || len(flows[0].ThreadFlows) != 1 {
+		t.Fatalf("expected one code flow with one thread flow, got %+v", flows)
+	}
+	locations := flows[0].ThreadFlows[0].Locations
+	if len(locations) != len(steps) {
+		t.Fatalf("expected %d steps, got %d", len(steps), len(locations))
+	}
+	for i, step := range steps {
+		loc := locations[i].Location.PhysicalLocation
+		if loc.ArtifactLocation.URI != step.File || loc.Region.StartLine != step.Start.Line || loc.Region.EndColumn != step.End.Column {
+			t.Errorf("step %d: expected %v, got %+v", i, step, loc)
+		}
+	}
+}
+
+func TestSarifNoCodeFlow(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EmitSarif([]*Diagnostic{NewDiagnostic(SeverityError, "plain")}, &buf); err != nil {
+		t.Fatalf("EmitSarif failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "codeFlows") {
+		t.Errorf("did not expect codeFlows without a code flow, got %s", buf.String())
+	}
+}
+
+func TestUnderlineForInvertedMultiline(t *testing.T) {
+	inverted := NewSourceRangeSpan("a.go", 3, 2, 1, 2)
+	normalized := inverted.Normalize()
+	for line := 1; line <= 3; line++ {
+		got := underlineFor(inverted, line, "")
+		expected := underlineFor(normalized, line, "")
+		if got.marks != expected.marks {
+			t.Errorf("line %d: expected marks %q, got %q", line, expected.marks, got.marks)
+		}
+	}
+	if marks := underlineFor(inverted, 3, "").marks; marks != "~~" {
+		t.Errorf("expected end line underlined up to column 2, got %q", marks)
+	}
+}
+
+func TestRenderPathsCanonicalizeZeroEnd(t *testing.T) {
+	source := "package main\n\nfunc main() {\n\tbad()\n}\n"
+	d := NewDiagnostic(SeverityError, "undefined: bad").
+		WithRange(SourceRange{File: "main.go", Start: Position{Line: 4, Column: 2}})
+
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.AddSource("main.go", source)
+	reporter.Report(d)
+	reported := buf.String()
+
+	if !strings.Contains(reported, "main.go:4:2") {
+		t.Fatalf("expected Report to show the canonical location, got %q", reported)
+	}
+	if formatted, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{d}); formatted != reported {
+		t.Errorf("expected FormatAs to match Report\nexpected:\n%s\ngot:\n%s", reported, formatted)
+	}
+	if got, want := reporter.RenderedHeight(d), strings.Count(reported, "\n"); got != want {
+		t.Errorf("expected RenderedHeight %d to match the printed height, got %d", want, got)
+	}
+}
+
+func TestUnderlineForMultilineStartingPastColumn80(t *testing.T) {
+	sr := NewSourceRangeSpan("a.go", 1, 100, 2, 3)
+	if marks := underlineFor(sr, 1, "").marks; marks != strings.Repeat(" ", 99)+"~" {
+		t.Errorf("expected a single tilde at column 100, got %q", marks)
+	}
+}
+
+func TestReportInvertedMultilineRange(t *testing.T) {
+	var inverted, normalized bytes.Buffer
+	source := "one\ntwo\nthree\nfour\n"
+
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&inverted)
+	reporter.AddSource("a.go", source)
+	reporter.Report(NewDiagnostic(SeverityError, "bad block").WithRange(NewSourceRangeSpan("a.go", 3, 2, 1, 2).WithLabel("here")))
+
+	reporter = NewErrorReporter().WithNoColor(true).WithWriter(&normalized)
+	reporter.AddSource("a.go", source)
+	reporter.Report(NewDiagnostic(SeverityError, "bad block").WithRange(NewSourceRangeSpan("a.go", 1, 2, 3, 2).WithLabel("here")))
+
+	if inverted.String() != normalized.String() {
+		t.Errorf("expected inverted range to render like its normalized form\ngot:\n%s\nexpected:\n%s", inverted.String(), normalized.String())
+	}
+	if !strings.Contains(inverted.String(), "  a.go:1:2\n") || !strings.Contains(inverted.String(), "~~ here") {
+		t.Errorf("expected location and label from normalized range, got %q", inverted.String())
+	}
+}
+
+func TestExportImportState(t *testing.T) {
+	source := "package main\n\nfunc main() {}\n"
+	original := NewErrorReporter().WithWriter(io.Discard).WithFormat(FormatGCC).WithWrapWidth(40)
+	original.AddSource("main.go", source)
+	original.ReportMany([]*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "first", "main.go", 1, 1),
+		NewDiagnosticWithLocation(SeverityError, "second", "main.go", 3, 6),
+		NewDiagnostic(SeverityWarning, "third"),
+		NewDiagnostic(SeverityNote, "hidden").Suppress(),
+	})
+	original.Collect(NewDiagnostic(SeverityWarning, "unused %s").WithArgs("x").WithCode("W01"))
+
+	data, err := original.ExportState()
+	if err != nil {
+		t.Fatalf("ExportState failed: %v", err)
+	}
+	if strings.Contains(string(data), "func main") {
+		t.Error("expected source content to be left out of the exported state")
+	}
+
+	restored := NewErrorReporter()
+	if err := restored.ImportState(data); err != nil {
+		t.Fatalf("ImportState failed: %v", err)
+	}
+
+	expected, got := original.CountBySeverity(), restored.CountBySeverity()
+	if len(got) != len(expected) {
+		t.Errorf("expected counts %v, got %v", expected, got)
+	}
+	for sev, n := range expected {
+		if got[sev] != n {
+			t.Errorf("severity %v: expected %d, got %d", sev, n, got[sev])
+		}
+	}
+	if restored.SuppressedCount() != 1 {
+		t.Errorf("expected 1 suppressed, got %d", restored.SuppressedCount())
+	}
+	if restored.Format != FormatGCC || restored.WrapWidth != 40 {
+		t.Errorf("expected config to be restored, got format %v and wrap width %d", restored.Format, restored.WrapWidth)
+	}
+
+	collected := restored.Collected()
+	if len(collected) != 1 || collected[0].ResolvedMessage() != "unused x" || *collected[0].Code != "W01" {
+		t.Errorf("expected collected diagnostic to be restored, got %+v", collected)
+	}
+
+	hash, ok := restored.CachedSourceHash("main.go")
+	if !ok || hash != SourceHash(source) {
+		t.Errorf("expected cached hash for main.go to match its content, got %q", hash)
+	}
+	if hash == SourceHash(source+"// changed\n") {
+		t.Error("expected hash to change with content")
+	}
+}
+
+func TestExportImportStateKeepsReportedHistory(t *testing.T) {
+	original := NewErrorReporter().WithWriter(io.Discard).WithDedupKey(DedupKeyMessage)
+	original.Report(NewDiagnostic(SeverityError, "broken"))
+
+	data, err := original.ExportState()
+	if err != nil {
+		t.Fatalf("ExportState failed: %v", err)
+	}
+
+	fired := 0
+	restored := NewErrorReporter().WithWriter(io.Discard).WithOnFirstError(func(*Diagnostic) { fired++ })
+	if err := restored.ImportState(data); err != nil {
+		t.Fatalf("ImportState failed: %v", err)
+	}
+	restored.WithDedupKey(DedupKeyMessage)
+	restored.Report(NewDiagnostic(SeverityError, "broken"))
+	restored.Report(NewDiagnostic(SeverityError, "also broken"))
+
+	if restored.TotalDiagnosticCount() != 2 {
+		t.Errorf("expected the duplicate to be skipped after import, got %d diagnostics", restored.TotalDiagnosticCount())
+	}
+	if fired != 0 {
+		t.Errorf("expected OnFirstError not to fire again after import, fired %d times", fired)
+	}
+}
+
+func TestImportStateInvalid(t *testing.T) {
+	if err := NewErrorReporter().ImportState([]byte("not json")); err == nil {
+		t.Error("expected error for invalid state")
+	}
+}
+
+func TestCollectCodes(t *testing.T) {
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityWarning, "unused variable %q").WithArgs("x").WithCode("W0100"),
+		NewDiagnostic(SeverityError, "type mismatch").WithCode("E0001"),
+		NewDiagnostic(SeverityError, "no code"),
+		NewDiagnostic(SeverityWarning, "unused variable %q").WithArgs("y").WithCode("W0100"),
+		NewDiagnostic(SeverityError, "type mismatch again").WithCode("E0001"),
+		NewDiagnostic(SeverityWarning, "unused variable %q").WithArgs("z").WithCode("W0100"),
+		NewDiagnostic(SeverityFatal, "out of memory").WithCode("F0001"),
+	}
+
+	expected := []CodeInfo{
+		{Code: "E0001", Severity: SeverityError, Count: 2, SampleMessage: "type mismatch"},
+		{Code: "F0001", Severity: SeverityFatal, Count: 1, SampleMessage: "out of memory"},
+		{Code: "W0100", Severity: SeverityWarning, Count: 3, SampleMessage: `unused variable "x"`},
+	}
+	if got := CollectCodes(ds); !slices.Equal(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	if got := CollectCodes([]*Diagnostic{NewDiagnostic(SeverityNote, "plain")}); len(got) != 0 {
+		t.Errorf("expected no codes, got %+v", got)
+	}
+}
+
+func TestGhostText(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithGhostText()
+	reporter.AddSource("main.go", "package main\n\nfunc main() {\n\tfmt.Prinln(\"hi\")\n}\n")
+
+	r := NewSourceRangeSpan("main.go", 4, 6, 4, 11)
+	reporter.Report(NewDiagnostic(SeverityError, "undefined: fmt.Prinln").
+		WithRange(r).
+		WithSuggestion(r, "Println"))
+
+	lines := strings.Split(buf.String(), "\n")
+	idx := slices.Index(lines, "     4 | \tfmt.Prinln(\"hi\")")
+	if idx < 0 || idx+2 >= len(lines) {
+		t.Fatalf("expected error line in output, got %q", buf.String())
+	}
+	if lines[idx+1] != "       | \tfmt.Println(\"hi\")" {
+		t.Errorf("expected ghost text right after source line, got %q", lines[idx+1])
+	}
+	if strings.TrimSpace(lines[idx+2]) != "~~~~~~" {
+		t.Errorf("expected underline after ghost text, got %q", lines[idx+2])
+	}
+}
+
+func TestGhostTextDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.AddSource("main.go", "x := 1\n")
+
+	r := NewSourceRangeSingle("main.go", 1, 1)
+	reporter.Report(NewDiagnostic(SeverityError, "bad name").WithRange(r).WithSuggestion(r, "y"))
+
+	if strings.Contains(buf.String(), "y := 1") {
+		t.Errorf("did not expect ghost text without WithGhostText, got %q", buf.String())
+	}
+}
+
+func TestReportToFile(t *testing.T) {
+	path := t.TempDir() + "/report.txt"
+	reporter := NewErrorReporter().WithNoColor(false).WithWriter(io.Discard)
+	reporter.AddSource("main.go", "package main\n\nfunc main() {}\n")
+
+	err := reporter.ReportToFile(path, []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "missing return", "main.go", 3, 14).WithCode("E0100"),
+		NewDiagnostic(SeverityWarning, "unused import"),
+	})
+	if err != nil {
+		t.Fatalf("ReportToFile failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading report: %v", err)
+	}
+	out := string(data)
+	if strings.Contains(out, "\x1b[") {
+		t.Errorf("expected no ANSI codes in file, got %q", out)
+	}
+	for _, want := range []string{"error[E0100]: missing return", "  main.go:3:14", "   3 | func main() {}", "warning: unused import"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in file, got %q", want, out)
+		}
+	}
+	if reporter.TotalDiagnosticCount() != 2 {
+		t.Errorf("expected 2 counted diagnostics, got %d", reporter.TotalDiagnosticCount())
+	}
+	if reporter.NoColor {
+		t.Error("expected the reporter's own color setting to be left alone")
+	}
+}
+
+func TestReportToFileBadPath(t *testing.T) {
+	path := t.TempDir() + "/missing/report.txt"
+	if err := NewErrorReporter().ReportToFile(path, nil); err == nil {
+		t.Error("expected error for a path in a missing directory")
+	}
+}
+
+func TestSourceText(t *testing.T) {
+	reporter := NewErrorReporter()
+	reporter.AddSource("main.go", "package main\n\nfunc main() {\n\tfmt.Prinln(\"hé\")\n}\n")
+
+	tests := []struct {
+		r        SourceRange
+		expected string
+	}{
+		{NewSourceRangeSpan("main.go", 4, 6, 4, 11), "Prinln"},
+		{NewSourceRangeSingle("main.go", 1, 1), "p"},
+		{NewSourceRangeSpan("main.go", 4, 13, 4, 16), `"hé"`},
+		{NewSourceRangeSpan("main.go", 3, 13, 4, 4), "{\n\tfmt"},
+	}
+	for _, tt := range tests {
+		got, err := reporter.SourceText(tt.r)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.r, err)
+		} else if got != tt.expected {
+			t.Errorf("%v: expected %q, got %q", tt.r, tt.expected, got)
+		}
+	}
+
+	if _, err := reporter.SourceText(NewSourceRangeSingle("other.go", 1, 1)); err == nil {
+		t.Error("expected error for unregistered source")
+	}
+	if _, err := reporter.SourceText(NewSourceRangeSingle("main.go", 99, 1)); err == nil {
+		t.Error("expected error for range outside the source")
+	}
+}
+
+func TestWithSuggestionFromRange(t *testing.T) {
+	reporter := NewErrorReporter()
+	reporter.AddSource("main.go", "package main\n\nfunc main() {\n\tfmt.Prinln(\"hi\")\n}\n")
+
+	r := NewSourceRangeSpan("main.go", 4, 6, 4, 11)
+	d, err := NewDiagnostic(SeverityError, "undefined: fmt.Prinln").WithRange(r).WithSuggestionFromRange(reporter, r, "Println")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(d.Suggestions) != 1 {
+		t.Fatalf("expected 1 suggestion, got %d", len(d.Suggestions))
+	}
+	s := d.Suggestions[0]
+	if s.Before != "Prinln" || s.Replacement != "Println" || s.Range != r {
+		t.Errorf("unexpected suggestion %+v", s)
+	}
+
+	d, err = NewDiagnostic(SeverityError, "x").WithSuggestionFromRange(reporter, NewSourceRangeSingle("other.go", 1, 1), "y")
+	if err == nil {
+		t.Error("expected error for unregistered source")
+	}
+	if len(d.Suggestions) != 0 {
+		t.Errorf("expected no suggestion on error, got %+v", d.Suggestions)
+	}
+}
+
+func TestHelpPosition(t *testing.T) {
+	render := func(pos HelpPosition) string {
+		var buf bytes.Buffer
+		reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithHelpPosition(pos)
+		reporter.AddSource("main.go", "package main\n\nfunc main() {}\n")
+		reporter.Report(NewDiagnosticWithLocation(SeverityError, "missing return", "main.go", 3, 14).
+			WithNote("function declared here").
+			WithHelp("add a return statement").
+			WithUrl("https://example.com/E1"))
+		return buf.String()
+	}
+
+	after := render(HelpAfter)
+	snippet := strings.Index(after, "   3 | func main() {}")
+	note := strings.Index(after, "  note: function declared here")
+	help := strings.Index(after, "  help: add a return statement")
+	see := strings.Index(after, "  see: https://example.com/E1")
+	if snippet < 0 || !(snippet < note && note < help && help < see) {
+		t.Errorf("expected snippet before note, help, and see with HelpAfter, got %q", after)
+	}
+
+	before := render(HelpBefore)
+	header := strings.Index(before, "error: missing return")
+	snippet = strings.Index(before, "   3 | func main() {}")
+	note = strings.Index(before, "  note: function declared here")
+	help = strings.Index(before, "  help: add a return statement")
+	see = strings.Index(before, "  see: https://example.com/E1")
+	if snippet < 0 || !(header < note && note < help && help < see && see < snippet) {
+		t.Errorf("expected note, help, and see before snippet with HelpBefore, got %q", before)
+	}
+}
+
+func TestGutterChar(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.GutterChar = "┃"
+	reporter.AddSource("main.go", "package main\n\nfunc main() {}\n")
+	reporter.Report(NewDiagnosticWithLocation(SeverityError, "missing return", "main.go", 3, 14))
+
+	out := buf.String()
+	if !strings.Contains(out, "   3 ┃ func main() {}") || !strings.Contains(out, "   1 ┃ package main") {
+		t.Errorf("expected custom gutter character in snippet, got %q", out)
+	}
+	if strings.Contains(out, " | ") {
+		t.Errorf("did not expect the default gutter, got %q", out)
+	}
+}
+
+func TestGutterStyle(t *testing.T) {
+	reporter := NewErrorReporter()
+	if reporter.GutterChar != "|" {
+		t.Errorf("expected default gutter %q, got %q", "|", reporter.GutterChar)
+	}
+	if reporter.WithGutterStyle(GutterStyleUnicode).GutterChar != "│" {
+		t.Errorf("expected unicode gutter, got %q", reporter.GutterChar)
+	}
+	if reporter.WithGutterStyle(GutterStyleASCII).GutterChar != "|" {
+		t.Errorf("expected ascii gutter, got %q", reporter.GutterChar)
+	}
+	if reporter.WithGutterChar(":").GutterChar != ":" {
+		t.Errorf("expected overridden gutter, got %q", reporter.GutterChar)
+	}
+}
+
+func TestSpots(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.AddSource("main.go", "x := a¤b + c¤d\n")
+
+	d := NewDiagnostic(SeverityError, "invalid character '¤'").
+		WithRange(NewSourceRangeSingle("main.go", 1, 7).WithLabel("not allowed")).
+		WithSpots(NewSourceRangeSingle("main.go", 1, 13), NewSourceRangeSingle("main.go", 5, 1))
+	if err := d.ValidateSpots(); err == nil {
+		t.Error("expected spot on another line to fail validation")
+	}
+	d.Spots = d.Spots[:1]
+	if err := d.ValidateSpots(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+
+	reporter.Report(d)
+	lines := strings.Split(buf.String(), "\n")
+	idx := slices.Index(lines, "     1 | x := a¤b + c¤d")
+	if idx < 0 {
+		t.Fatalf("expected source line, got %q", buf.String())
+	}
+	if expected := "               ^     ^-- not allowed"; lines[idx+1] != expected {
+		t.Errorf("expected both spots on one row\nexpected: %q\ngot:      %q", expected, lines[idx+1])
+	}
+}
+
+func TestSpotsWithSpan(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.AddSource("a.go", "call(foo, bar, foo)\n")
+
+	reporter.Report(NewDiagnostic(SeverityWarning, "duplicate argument").
+		WithRange(NewSourceRangeSpan("a.go", 1, 16, 1, 18)).
+		WithSpots(NewSourceRangeSpan("a.go", 1, 6, 1, 8)))
+
+	if !strings.Contains(buf.String(), "\n              ~~~       ~~~\n") {
+		t.Errorf("expected span spot before primary range, got %q", buf.String())
+	}
+}
+
+func TestValidateSpotsMultilinePrimary(t *testing.T) {
+	d := NewDiagnosticWithRange(SeverityError, "x", "a.go", 1, 1, 2, 1).WithSpots(NewSourceRangeSingle("a.go", 1, 3))
+	if err := d.ValidateSpots(); err == nil {
+		t.Error("expected error for multiline primary range")
+	}
+	if err := NewDiagnostic(SeverityError, "no spots").ValidateSpots(); err != nil {
+		t.Errorf("unexpected error without spots: %v", err)
+	}
+}
+
+func TestWithFile(t *testing.T) {
+	d := NewDiagnosticWithLocation(SeverityError, "bad call", "tmp_42.go", 3, 5).
+		WithSecondaryRange(NewSourceRangeSingle("tmp_42.go", 1, 1)).
+		WithNoteAt("declared here", "tmp_42.go", 2, 6).
+		WithNote("no location").
+		WithSpots(NewSourceRangeSingle("tmp_42.go", 3, 9)).
+		WithSuggestion(NewSourceRangeSingle("tmp_42.go", 3, 5), "x")
+
+	d.WithFile("user_file.go")
+
+	if d.Range.File != "user_file.go" {
+		t.Errorf("expected primary range file to change, got %q", d.Range.File)
+	}
+	if d.SecondaryRanges[0].File != "user_file.go" {
+		t.Errorf("expected secondary range file to change, got %q", d.SecondaryRanges[0].File)
+	}
+	if d.Notes[0].Range.File != "user_file.go" {
+		t.Errorf("expected note range file to change, got %q", d.Notes[0].Range.File)
+	}
+	if d.Notes[1].Range != nil {
+		t.Error("expected note without range to stay without range")
+	}
+	if d.Spots[0].File != "user_file.go" || d.Suggestions[0].Range.File != "user_file.go" {
+		t.Errorf("expected spot and suggestion files to change, got %q and %q", d.Spots[0].File, d.Suggestions[0].Range.File)
+	}
+
+	flow := NewDiagnosticWithLocation(SeverityError, "tainted", "tmp_42.go", 5, 1).
+		WithCodeFlow([]SourceRange{NewSourceRangeSingle("tmp_42.go", 1, 1), NewSourceRangeSingle("tmp_42.go", 5, 1)}).
+		WithFile("user_file.go")
+	for i, step := range flow.CodeFlow {
+		if step.File != "user_file.go" {
+			t.Errorf("expected code flow step %d file to change, got %q", i, step.File)
+		}
+	}
+	var sarif bytes.Buffer
+	if err := EmitSarif([]*Diagnostic{flow}, &sarif); err != nil {
+		t.Fatalf("EmitSarif failed: %v", err)
+	}
+	if strings.Contains(sarif.String(), "tmp_42.go") {
+		t.Errorf("expected no SARIF location to keep the old file, got %s", sarif.String())
+	}
+
+	plain := NewDiagnostic(SeverityNote, "no range").WithFile("user_file.go")
+	if plain.Range != nil {
+		t.Error("expected WithFile to be a no-op without a range")
+	}
+}
+
+func TestRenderedHeight(t *testing.T) {
+	source := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tx := 42\n\ty := x + \"hello\"\n\tfmt.Println(y)\n}\n"
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityWarning, "no location"),
+		NewDiagnosticWithLocation(SeverityError, "near the top", "main.go", 1, 1),
+		NewDiagnosticWithRange(SeverityError, "type mismatch", "main.go", 7, 7, 7, 17).
+			WithHelp("convert x first").
+			WithCode("E0001").
+			WithUrl("https://example.com/E0001"),
+		NewDiagnosticWithRange(SeverityError, "bad block", "main.go", 5, 13, 9, 1).
+			WithNoteAt("x declared here", "main.go", 6, 2).
+			WithSecondaryRange(NewSourceRangeSingle("main.go", 3, 8)),
+		NewDiagnosticWithLocation(SeverityNote, "missing source", "other.go", 2, 2),
+	}
+
+	for _, format := range []OutputFormat{FormatFehler, FormatGCC, FormatMSVC} {
+		for _, wrap := range []int{0, 8} {
+			reporter := NewErrorReporter().WithFormat(format).WithWrapWidth(wrap)
+			reporter.AddSource("main.go", source)
+			for i, d := range ds {
+				out, err := reporter.FormatAs(format, []*Diagnostic{d})
+				if err != nil {
+					t.Fatalf("FormatAs failed: %v", err)
+				}
+				if got, expected := reporter.RenderedHeight(d), strings.Count(out, "\n"); got != expected {
+					t.Errorf("format %d, wrap %d, diagnostic %d: expected height %d, got %d", format, wrap, i, expected, got)
+				}
+			}
+		}
+	}
+
+	reporter := NewErrorReporter().WithWriter(io.Discard)
+	reporter.RenderedHeight(ds[0])
+	if reporter.TotalDiagnosticCount() != 0 {
+		t.Error("expected RenderedHeight not to count the diagnostic")
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	source := "package main\n\nfunc main() {\n\tx := 42\n\ty := x + \"hello\"\n\tprintln(y)\n}\n"
+	d := NewDiagnosticWithRange(SeverityError, "type mismatch: cannot add %s and %s", "example.go", 5, 7, 5, 17).
+		WithArgs("int", "string").
+		WithHelp("convert x with strconv.Itoa").
+		WithCode("E0001").
+		WithUrl("https://docs.example.org/errors/E0001")
+
+	md := RenderMarkdown(d, source)
+
+	if !strings.HasPrefix(md, "**error** `E0001`: type mismatch: cannot add int and string\n") {
+		t.Errorf("expected bold severity header, got %q", md)
+	}
+	if !strings.Contains(md, "In `example.go` at line 5, column 7:") {
+		t.Errorf("expected location sentence, got %q", md)
+	}
+	block := "```go\nfunc main() {\n\tx := 42\n\ty := x + \"hello\"\n\tprintln(y)\n}\n```\n"
+	if !strings.Contains(md, block) {
+		t.Errorf("expected fenced code block %q, got %q", block, md)
+	}
+	if !strings.Contains(md, "> **help:** convert x with strconv.Itoa\n") {
+		t.Errorf("expected help in blockquote, got %q", md)
+	}
+	if !strings.HasSuffix(md, "> **see:** https://docs.example.org/errors/E0001\n") {
+		t.Errorf("expected URL blockquote at the end, got %q", md)
+	}
+	if strings.Contains(md, "\x1b[") {
+		t.Errorf("expected no ANSI codes, got %q", md)
+	}
+}
+
+func TestRenderMarkdownWithoutRange(t *testing.T) {
+	md := RenderMarkdown(NewDiagnostic(SeverityWarning, "deprecated flag"), "")
+	if md != "**warning**: deprecated flag\n" {
+		t.Errorf("unexpected markdown %q", md)
+	}
+}
+
+func TestUnderlineColor(t *testing.T) {
+	render := func(underline string) string {
+		var buf bytes.Buffer
+		reporter := NewErrorReporter().WithNoColor(false).WithWriter(&buf).WithUnderlineColor(underline)
+		reporter.AddSource("main.go", "x := 1 + \"a\"\n")
+		reporter.Report(NewDiagnosticWithRange(SeverityError, "mismatched types", "main.go", 1, 6, 1, 12))
+		return buf.String()
+	}
+
+	out := render("\x1b[36m")
+	if !strings.HasPrefix(out, colorRed+colorBold+"error") {
+		t.Errorf("expected header label in severity color, got %q", out)
+	}
+	underline := "  \x1b[36m" + strings.Repeat(" ", lineNumWidth+1) + "  " + strings.Repeat(" ", 5) + "~~~~~~~"
+	if !strings.Contains(out, underline) {
+		t.Errorf("expected underline in configured color, got %q", out)
+	}
+
+	out = render("")
+	underline = "  " + colorRed + strings.Repeat(" ", lineNumWidth+1) + "  " + strings.Repeat(" ", 5) + "~~~~~~~"
+	if !strings.Contains(out, underline) {
+		t.Errorf("expected underline in severity color by default, got %q", out)
+	}
+}
+
+func TestMessagePrefix(t *testing.T) {
+	for _, format := range []OutputFormat{FormatFehler, FormatGCC, FormatMSVC} {
+		var buf bytes.Buffer
+		reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithFormat(format).WithMessagePrefix("mycompiler: ")
+		d := NewDiagnosticWithLocation(SeverityError, "undefined variable", "main.go", 2, 3)
+		reporter.Report(d)
+
+		if !strings.Contains(buf.String(), "mycompiler: undefined variable") {
+			t.Errorf("format %d: expected prefixed message, got %q", format, buf.String())
+		}
+		if d.Message != "undefined variable" {
+			t.Errorf("format %d: expected diagnostic to be left unchanged, got %q", format, d.Message)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	reporter := NewErrorReporter()
+	reporter.AddSource("main.go", "package main\n\nfunc main() {}\n")
+
+	ds := []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "fine", "main.go", 3, 6),
+		NewDiagnosticWithLocation(SeverityError, "forgot to register", "util.go", 1, 1),
+		NewDiagnostic(SeverityWarning, "no range"),
+		NewDiagnosticWithRange(SeverityError, "past the end", "main.go", 2, 1, 4, 1),
+		NewDiagnostic(SeverityNote, "file only").WithRange(SourceRange{File: "main.go"}),
+	}
+
+	errs := reporter.Validate(ds)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %v", len(errs), errs)
+	}
+	if !strings.Contains(errs[0].Error(), `"forgot to register"`) || !strings.Contains(errs[0].Error(), `no source registered for "util.go"`) {
+		t.Errorf("unexpected error for missing file: %v", errs[0])
+	}
+	if !strings.Contains(errs[1].Error(), `"past the end"`) || !strings.Contains(errs[1].Error(), "line 4 is past the end") {
+		t.Errorf("unexpected error for out-of-range line: %v", errs[1])
+	}
+
+	if errs := reporter.Validate(ds[:1]); len(errs) != 0 {
+		t.Errorf("expected no errors for valid diagnostics, got %v", errs)
+	}
+}
+
+func TestNewSourceRangeFromMatch(t *testing.T) {
+	text := `	msg := "héllo" + wörld`
+	re := regexp.MustCompile(`w\pL+`)
+
+	m := re.FindStringIndex(text)
+	r := NewSourceRangeFromMatch("main.go", 7, text, m)
+	expected := NewSourceRangeSpan("main.go", 7, 19, 7, 23)
+	if r != expected {
+		t.Errorf("expected %v, got %v", expected, r)
+	}
+	if !r.IsValid() {
+		t.Error("expected range from a match to be valid")
+	}
+
+	runes := []rune(text)
+	if got := string(runes[r.Start.Column-1 : r.End.Column]); got != "wörld" {
+		t.Errorf("expected columns to bracket the match, got %q", got)
+	}
+
+	empty := NewSourceRangeFromMatch("main.go", 1, "abc", []int{1, 1})
+	if empty != NewSourceRangeSingle("main.go", 1, 2) {
+		t.Errorf("expected single-character range for empty match, got %v", empty)
+	}
+
+	none := NewSourceRangeFromMatch("main.go", 7, text, regexp.MustCompile(`nope`).FindStringIndex(text))
+	if none != (SourceRange{}) || none.IsValid() {
+		t.Errorf("expected zero invalid range for no match, got %v", none)
+	}
+	if NewSourceRangeFromMatch("main.go", 1, "abc", []int{2, 10}).IsValid() {
+		t.Error("expected out-of-bounds match to be invalid")
+	}
+}
+
+func TestMaxSnippetLines(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithShowEllipsis(false).WithMaxSnippetLines(6)
+	reporter.AddSource("big.txt", numberedSource(100))
+	reporter.Report(NewDiagnosticWithRange(SeverityError, "unterminated block", "big.txt", 20, 1, 79, 5))
+
+	out := buf.String()
+	for _, line := range []int{18, 19, 20, 21, 22, 77, 78, 79, 80, 81} {
+		if !strings.Contains(out, fmt.Sprintf("%4d | line %d\n", line, line)) {
+			t.Errorf("expected line %d to be shown, got %q", line, out)
+		}
+	}
+	for _, line := range []int{23, 50, 76} {
+		if strings.Contains(out, fmt.Sprintf("| line %d\n", line)) {
+			t.Errorf("expected line %d to be omitted, got %q", line, out)
+		}
+	}
+	if !strings.Contains(out, "   22 | line 22\n") {
+		t.Errorf("expected last head line, got %q", out)
+	}
+	if !strings.Contains(out, "\n  ... 54 lines omitted ...\n    77 | line 77\n") {
+		t.Errorf("expected omission marker before the tail, got %q", out)
+	}
+}
+
+func TestMaxSnippetLinesOne(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithShowEllipsis(false).WithMaxSnippetLines(1)
+	reporter.AddSource("big.txt", numberedSource(100))
+	sr := NewSourceRangeSpan("big.txt", 20, 1, 30, 5)
+	sr.Label = "END"
+	reporter.Report(NewDiagnostic(SeverityError, "unterminated block").WithRange(sr))
+
+	out := buf.String()
+	for _, line := range []int{20, 30} {
+		if !strings.Contains(out, fmt.Sprintf("%4d | line %d\n", line, line)) {
+			t.Errorf("expected line %d to be shown, got %q", line, out)
+		}
+	}
+	if !strings.Contains(out, "... 9 lines omitted ...") {
+		t.Errorf("expected the lines between to be folded, got %q", out)
+	}
+	if !strings.Contains(out, "~~~~~ END\n") {
+		t.Errorf("expected the last line's label to be printed, got %q", out)
+	}
+
+	buf.Reset()
+	reporter.Report(NewDiagnosticWithRange(SeverityError, "two lines", "big.txt", 40, 1, 41, 3))
+	if strings.Contains(buf.String(), "omitted") || !strings.Contains(buf.String(), "  41 | line 41\n") {
+		t.Errorf("expected a two-line range to be shown in full, got %q", buf.String())
+	}
+}
+
+func TestMaxSnippetLinesShortRange(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithMaxSnippetLines(6)
+	reporter.AddSource("big.txt", numberedSource(100))
+	reporter.Report(NewDiagnosticWithRange(SeverityError, "short block", "big.txt", 20, 1, 25, 5))
+
+	if strings.Contains(buf.String(), "omitted") {
+		t.Errorf("did not expect folding within the limit, got %q", buf.String())
+	}
+}
+
+func TestMaxGroupSize(t *testing.T) {
+	d := NewDiagnostic(SeverityError, "conflicting definitions")
+	for i := 1; i <= 10; i++ {
+		d.WithNote(fmt.Sprintf("candidate %d", i))
+	}
+
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithMaxGroupSize(3)
+	reporter.Report(d)
+
+	out := buf.String()
+	if n := strings.Count(out, "  note: "); n != 3 {
+		t.Errorf("expected 3 notes, got %d in %q", n, out)
+	}
+	if !strings.Contains(out, "  note: candidate 3\n  ... 7 more (use -v to show all)\n") {
+		t.Errorf("expected summary line after the shown notes, got %q", out)
+	}
+	if strings.Contains(out, "candidate 4") {
+		t.Errorf("did not expect collapsed notes, got %q", out)
+	}
+}
+
+func TestMaxGroupSizeDefault(t *testing.T) {
+	d := NewDiagnostic(SeverityError, "too many places")
+	for i := 1; i <= 7; i++ {
+		d.WithSecondaryRange(SourceRange{File: fmt.Sprintf("file%d.go", i)})
+	}
+
+	reporter := NewErrorReporter()
+	if reporter.MaxGroupSize != 5 {
+		t.Errorf("expected default MaxGroupSize 5, got %d", reporter.MaxGroupSize)
+	}
+	out, _ := reporter.WithNoColor(true).FormatAs(FormatFehler, []*Diagnostic{d})
+	if !strings.Contains(out, "  file5.go\n  ... 2 more (use -v to show all)\n") || strings.Contains(out, "file6.go") {
+		t.Errorf("expected secondary ranges collapsed after 5, got %q", out)
+	}
+
+	out, _ = reporter.WithMaxGroupSize(0).FormatAs(FormatFehler, []*Diagnostic{d})
+	if !strings.Contains(out, "file7.go") || strings.Contains(out, "more") {
+		t.Errorf("expected all secondary ranges with MaxGroupSize 0, got %q", out)
+	}
+}
+
+func TestDocURLTemplate(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithDocURLTemplate("https://errors.example.com/{code}")
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{NewDiagnostic(SeverityError, "type mismatch").WithCode("E0001")})
+	if !strings.Contains(out, "  see: https://errors.example.com/E0001\n") {
+		t.Errorf("expected synthesized URL, got %q", out)
+	}
+
+	out, _ = reporter.FormatAs(FormatFehler, []*Diagnostic{
+		NewDiagnostic(SeverityError, "type mismatch").WithCode("E0001").WithUrl("https://docs.example.org/custom"),
+	})
+	if !strings.Contains(out, "  see: https://docs.example.org/custom\n") || strings.Contains(out, "errors.example.com") {
+		t.Errorf("expected explicit URL to take precedence, got %q", out)
+	}
+
+	out, _ = reporter.FormatAs(FormatFehler, []*Diagnostic{NewDiagnostic(SeverityError, "no code")})
+	if strings.Contains(out, "see:") {
+		t.Errorf("did not expect a see line without a code, got %q", out)
+	}
+}
+
+func TestDiagnosticBuilder(t *testing.T) {
+	ds := NewDiagnosticBuilder().
+		AddError("undefined: x").
+		AddWarningAt("unused variable", "main.go", 4, 2).
+		Add(NewDiagnostic(SeverityNote, "build finished")).
+		Build()
+
+	if len(ds) != 3 {
+		t.Fatalf("expected 3 diagnostics, got %d", len(ds))
+	}
+	expected := []Severity{SeverityError, SeverityWarning, SeverityNote}
+	for i, d := range ds {
+		if d.Severity != expected[i] {
+			t.Errorf("diagnostic %d: expected %v, got %v", i, expected[i], d.Severity)
+		}
+	}
+	if ds[1].Range == nil || *ds[1].Range != NewSourceRangeSingle("main.go", 4, 2) {
+		t.Errorf("expected warning location main.go:4:2, got %v", ds[1].Range)
+	}
+}
+
+func TestNewBatch(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+
+	ds := reporter.NewBatch().AddError("first").AddError("second").Build()
+	if len(ds) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d", len(ds))
+	}
+	if reporter.CountBySeverity()[SeverityError] != 2 {
+		t.Errorf("expected Build to report both errors, got %v", reporter.CountBySeverity())
+	}
+	if !strings.Contains(buf.String(), "error: first") || !strings.Contains(buf.String(), "error: second") {
+		t.Errorf("expected both errors in output, got %q", buf.String())
+	}
+}
+
+func TestEmitSarifLevelOverride(t *testing.T) {
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityUnimplemented, "not implemented").WithCode("U001"),
+		NewDiagnostic(SeverityTodo, "todo"),
+		NewDiagnostic(SeverityError, "broken"),
+	}
+	levels := func(opts SarifOptions) []string {
+		var buf bytes.Buffer
+		if err := EmitSarifWithOptions(ds, &buf, opts); err != nil {
+			t.Fatalf("EmitSarifWithOptions failed: %v", err)
+		}
+		report, err := ParseSarif(&buf)
+		if err != nil {
+			t.Fatalf("ParseSarif failed: %v", err)
+		}
+		var out []string
+		for _, res := range report.Runs[0].Results {
+			out = append(out, res.Level)
+		}
+		if rules := report.Runs[0].Tool.Driver.Rules; len(rules) != 1 || rules[0].DefaultConfiguration.Level != out[0] {
+			t.Errorf("expected rule level to match result level %q, got %+v", out[0], rules)
+		}
+		return out
+	}
+
+	if got := levels(SarifOptions{}); !slices.Equal(got, []string{"none", "none", "error"}) {
+		t.Errorf("expected default levels, got %v", got)
+	}
+
+	override := SarifOptions{SarifLevelFor: func(sev Severity) string {
+		if sev == SeverityUnimplemented {
+			return "warning"
+		}
+		return sarifLevel(sev)
+	}}
+	if got := levels(override); !slices.Equal(got, []string{"warning", "none", "error"}) {
+		t.Errorf("expected overridden levels, got %v", got)
+	}
+}
+
+func TestToGCCAndMSVCString(t *testing.T) {
+	r := NewSourceRangeSpan("main.go", 5, 12, 5, 20)
+	if got := r.ToGCCString(); got != "main.go:5:12" {
+		t.Errorf("expected %q, got %q", "main.go:5:12", got)
+	}
+	if got := r.ToMSVCString(); got != "main.go(5, 12)" {
+		t.Errorf("expected %q, got %q", "main.go(5, 12)", got)
+	}
+
+	inverted := NewSourceRangeSpan("main.go", 7, 3, 5, 12)
+	if got := inverted.ToGCCString(); got != "main.go:5:12" {
+		t.Errorf("expected normalized start, got %q", got)
+	}
+
+	var nilRange *SourceRange
+	if got := nilRange.ToGCCString(); got != "<unknown>:0:0" {
+		t.Errorf("expected %q for nil, got %q", "<unknown>:0:0", got)
+	}
+	if got := nilRange.ToMSVCString(); got != "<unknown>(0, 0)" {
+		t.Errorf("expected %q for nil, got %q", "<unknown>(0, 0)", got)
+	}
+
+	var zero SourceRange
+	if got := zero.ToGCCString(); got != "<unknown>:0:0" {
+		t.Errorf("expected %q for zero value, got %q", "<unknown>:0:0", got)
+	}
+	if got := zero.ToMSVCString(); got != "<unknown>(0, 0)" {
+		t.Errorf("expected %q for zero value, got %q", "<unknown>(0, 0)", got)
+	}
+}
+
+func TestCollapseRepeats(t *testing.T) {
+	source := "func f() {\n\n\n\n\n\n\treturn\n}\n"
+	render := func(collapse bool) string {
+		reporter := NewErrorReporter().WithNoColor(true).WithCollapseRepeats(collapse)
+		reporter.AddSource("f.go", source)
+		out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{
+			NewDiagnosticWithRange(SeverityWarning, "function body is mostly blank", "f.go", 1, 10, 7, 7),
+		})
+		return out
+	}
+
+	out := render(true)
+	if !strings.Contains(out, "     1 | func f() {\n") {
+		t.Errorf("expected first line of the range, got %q", out)
+	}
+	if !strings.Contains(out, "\n  ⋮ (5 identical lines)\n     7 | \treturn\n") {
+		t.Errorf("expected blank lines collapsed before the last range line, got %q", out)
+	}
+	if strings.Contains(out, "     3 | \n") {
+		t.Errorf("did not expect collapsed lines to be printed, got %q", out)
+	}
+
+	if out := render(false); strings.Contains(out, "identical lines") {
+		t.Errorf("did not expect collapse when disabled, got %q", out)
+	}
+}
+
+func TestCollapseRepeatsShortRun(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithCollapseRepeats(true)
+	reporter.AddSource("f.go", "a\n\n\nb\n")
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{NewDiagnosticWithRange(SeverityWarning, "x", "f.go", 1, 1, 4, 1)})
+	if strings.Contains(out, "identical lines") {
+		t.Errorf("did not expect a run of two lines to collapse, got %q", out)
+	}
+}
+
+func TestContextLineProvider(t *testing.T) {
+	stored := map[string]string{
+		"db://main.go": "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Prinln(\"hi\")\n}\n",
+	}
+	provider := func(file string, startLine, endLine int) ([]string, error) {
+		content, ok := stored[file]
+		if !ok {
+			return nil, fmt.Errorf("no such file %s", file)
+		}
+		var lines []string
+		scanner := bufio.NewScanner(strings.NewReader(content))
+		for n := 1; scanner.Scan() && n <= endLine; n++ {
+			if n >= startLine {
+				lines = append(lines, scanner.Text())
+			}
+		}
+		return lines, scanner.Err()
+	}
+
+	reporter := NewErrorReporter().WithNoColor(true).WithContextLineProvider(provider)
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{
+		NewDiagnosticWithRange(SeverityError, "undefined: fmt.Prinln", "db://main.go", 6, 6, 6, 11),
+	})
+
+	expected := "  ...\n" +
+		"     4 | \n" +
+		"     5 | func main() {\n" +
+		"     6 | \tfmt.Prinln(\"hi\")\n" +
+		"              ~~~~~~\n" +
+		"     7 | }\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected snippet from provider\nexpected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	out, _ = reporter.FormatAs(FormatFehler, []*Diagnostic{NewDiagnosticWithLocation(SeverityError, "oops", "db://missing.go", 1, 1)})
+	if !strings.Contains(out, "  (source unavailable: no such file db://missing.go)\n") {
+		t.Errorf("expected unavailable message, got %q", out)
+	}
+
+	reporter.AddSource("db://main.go", "package stale\n\n\n\nfunc old() {\n\tfmt.Prinln(\"bye\")\n}\n")
+	out, _ = reporter.FormatAs(FormatFehler, []*Diagnostic{
+		NewDiagnosticWithRange(SeverityError, "undefined: fmt.Prinln", "db://main.go", 6, 6, 6, 11),
+	})
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected the provider to be used for a registered file\nexpected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestSeverityChangeAnnotation(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.RegisterCode("W001", SeverityWarning)
+	reporter.RegisterCode("E001", SeverityError)
+
+	tests := []struct {
+		d        *Diagnostic
+		expected string
+	}{
+		{NewDiagnostic(SeverityError, "unused variable").WithCode("W001"), "error[W001, escalated]: unused variable\n"},
+		{NewDiagnostic(SeverityWarning, "unused variable").WithCode("W001"), "warning[W001]: unused variable\n"},
+		{NewDiagnostic(SeverityWarning, "type mismatch").WithCode("E001"), "warning[E001, demoted]: type mismatch\n"},
+		{NewDiagnostic(SeverityError, "unregistered").WithCode("X999"), "error[X999]: unregistered\n"},
+	}
+	for _, tt := range tests {
+		out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{tt.d})
+		if !strings.HasPrefix(out, tt.expected) {
+			t.Errorf("expected header %q, got %q", tt.expected, out)
+		}
+	}
+}
+
+func TestDedupKeyMessage(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithDedupKey(DedupKeyMessage)
+	reporter.ReportMany([]*Diagnostic{
+		NewDiagnosticWithLocation(SeverityWarning, "deprecated API", "a.go", 1, 1),
+		NewDiagnosticWithLocation(SeverityWarning, "deprecated API", "b.go", 7, 3),
+	})
+
+	if n := strings.Count(buf.String(), "warning: deprecated API"); n != 1 {
+		t.Errorf("expected one printed diagnostic, got %d in %q", n, buf.String())
+	}
+	if strings.Contains(buf.String(), "b.go") {
+		t.Errorf("expected the duplicate to be skipped, got %q", buf.String())
+	}
+	if reporter.TotalDiagnosticCount() != 1 {
+		t.Errorf("expected the duplicate not to be counted, got %d", reporter.TotalDiagnosticCount())
+	}
+}
+
+func TestDedupKeys(t *testing.T) {
+	a := NewDiagnosticWithLocation(SeverityError, "bad", "a.go", 2, 3).WithCode("E1")
+	sameSpot := NewDiagnosticWithLocation(SeverityWarning, "other", "a.go", 2, 3)
+	otherColumn := NewDiagnosticWithLocation(SeverityError, "bad", "a.go", 2, 4).WithCode("E1")
+
+	if DedupKeyLocation(a) != DedupKeyLocation(sameSpot) {
+		t.Error("expected same location key for diagnostics at the same position")
+	}
+	if DedupKeyFull(a) == DedupKeyFull(sameSpot) || DedupKeyFull(a) == DedupKeyFull(otherColumn) {
+		t.Error("expected full key to distinguish severity, message, and column")
+	}
+	if DedupKeyFull(a) != DedupKeyFull(NewDiagnosticWithLocation(SeverityError, "bad", "a.go", 2, 3).WithCode("E1")) {
+		t.Error("expected equal diagnostics to share a full key")
+	}
+
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.ReportMany([]*Diagnostic{a, a})
+	if reporter.TotalDiagnosticCount() != 2 {
+		t.Errorf("expected no dedup without DedupKey, got %d", reporter.TotalDiagnosticCount())
+	}
+
+	reporter = NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithDedupKey(DedupKeyLocation)
+	reporter.ReportMany([]*Diagnostic{
+		NewDiagnostic(SeverityError, "first"),
+		NewDiagnostic(SeverityError, "second"),
+	})
+	if reporter.TotalDiagnosticCount() != 2 {
+		t.Errorf("expected diagnostics without a range not to be deduplicated, got %d", reporter.TotalDiagnosticCount())
+	}
+}
+
+func TestVisualColumn(t *testing.T) {
+	tests := []struct {
+		line     string
+		col      int
+		tabWidth int
+		expected int
+	}{
+		{"abc", 2, 4, 2},
+		{"\tx", 1, 4, 1},
+		{"\tx", 2, 4, 5},
+		{"a\tx", 3, 4, 5},
+		{"abc\tx", 5, 4, 5},
+		{"abcd\tx", 6, 4, 9},
+		{"\t\tx", 3, 8, 17},
+		{"a\tb\tc", 5, 4, 9},
+		{"\tx", 4, 4, 7},
+		{"\tx", 2, 0, 2},
+	}
+	for _, tt := range tests {
+		if got := visualColumn(tt.line, tt.col, tt.tabWidth); got != tt.expected {
+			t.Errorf("visualColumn(%q, %d, %d): expected %d, got %d", tt.line, tt.col, tt.tabWidth, tt.expected, got)
+		}
+	}
+}
+
+func TestTabWidthUnderline(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithTabWidth(4)
+	reporter.AddSource("main.go", "a\tb := c\t+ d\n")
+
+	// Columns 3 to 10 cover "b := c\t+", crossing the second tab.
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{NewDiagnosticWithRange(SeverityError, "bad", "main.go", 1, 3, 1, 10)})
+	lines := strings.Split(out, "\n")
+	idx := slices.Index(lines, "     1 | a   b := c  + d")
+	if idx < 0 {
+		t.Fatalf("expected tabs expanded to stops of 4, got %q", out)
+	}
+	prefix := strings.Repeat(" ", 2+lineNumWidth+1+2)
+	if expected := prefix + "    ~~~~~~~~~"; lines[idx+1] != expected {
+		t.Errorf("expected underline on visual columns\nexpected: %q\ngot:      %q", expected, lines[idx+1])
+	}
+
+	out, _ = reporter.FormatAs(FormatFehler, []*Diagnostic{NewDiagnosticWithLocation(SeverityError, "bad", "main.go", 1, 12)})
+	if !strings.Contains(out, "\n"+prefix+strings.Repeat(" ", 14)+"^\n") {
+		t.Errorf("expected caret under d on visual column 15, got %q", out)
+	}
+}
+
+func TestMaxLineWidth(t *testing.T) {
+	line := strings.Repeat("abcdefghij", 6)
+	reporter := NewErrorReporter().WithNoColor(true).WithMaxLineWidth(20)
+	reporter.ShowTruncationColumn = true
+	reporter.AddSource("long.txt", line+"\n")
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{NewDiagnosticWithRange(SeverityError, "too long", "long.txt", 1, 15, 1, 40)})
+	lines := strings.Split(out, "\n")
+	idx := slices.Index(lines, "     1 | "+line[:19]+"… [+41 chars]")
+	if idx < 0 {
+		t.Fatalf("expected truncated line with indicator and count, got %q", out)
+	}
+
+	marks := strings.TrimPrefix(lines[idx+1], strings.Repeat(" ", 2+lineNumWidth+1+2))
+	if utf8.RuneCountInString(marks) > 20 {
+		t.Errorf("expected underline within 20 columns, got %d: %q", utf8.RuneCountInString(marks), marks)
+	}
+	if marks != strings.Repeat(" ", 14)+strings.Repeat("~", 6) {
+		t.Errorf("expected underline clipped at the truncation point, got %q", marks)
+	}
+
+	reporter.ShowTruncationColumn = false
+	reporter.TruncationIndicator = ">>"
+	out, _ = reporter.FormatAs(FormatFehler, []*Diagnostic{NewDiagnosticWithLocation(SeverityError, "x", "long.txt", 1, 1)})
+	if !strings.Contains(out, "     1 | "+line[:18]+">>\n") {
+		t.Errorf("expected custom indicator without count, got %q", out)
+	}
+
+	reporter.TruncationIndicator = "…"
+	out, _ = reporter.FormatAs(FormatFehler, []*Diagnostic{NewDiagnosticWithLocation(SeverityError, "x", "long.txt", 1, 45)})
+	lines = strings.Split(out, "\n")
+	idx = slices.Index(lines, "     1 | "+line[:19]+"…")
+	if idx < 0 {
+		t.Fatalf("expected truncated line, got %q", out)
+	}
+	if marks := strings.TrimPrefix(lines[idx+1], strings.Repeat(" ", 2+lineNumWidth+1+2)); marks != strings.Repeat(" ", 19)+"^" {
+		t.Errorf("expected a caret under the indicator for a cut-off location, got %q", marks)
+	}
+
+	colored := NewErrorReporter().WithNoColor(false).WithMaxLineWidth(20).WithWrapWidth(10)
+	colored.ShowTruncationColumn = true
+	colored.AddSource("long.txt", line+"\n")
+	out, _ = colored.FormatAs(FormatFehler, []*Diagnostic{NewDiagnosticWithLocation(SeverityError, "x", "long.txt", 1, 1)})
+	if !strings.Contains(out, " abcdefghi… "+colorDim+"[+41 chars]"+colorReset+"\n") {
+		t.Errorf("expected count appended whole to the last wrapped row, got %q", out)
+	}
+}
+
+func TestAlignLabels(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithAlignLabels(true)
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityError, "first message"),
+		NewDiagnostic(SeverityWarning, "second message"),
+		NewDiagnostic(SeverityNote, "third message"),
+		NewDiagnostic(SeverityUnimplemented, "fourth message"),
+	}
+
+	out, _ := reporter.FormatAs(FormatFehler, ds)
+	column := -1
+	for _, line := range strings.Split(out, "\n") {
+		i := strings.Index(line, " message")
+		if i < 0 {
+			continue
+		}
+		start := strings.LastIndex(line[:i], " ") + 1
+		if column < 0 {
+			column = start
+		} else if start != column {
+			t.Errorf("expected message at column %d, got %d in %q", column, start, line)
+		}
+	}
+	if column != len("unimplemented: ") {
+		t.Errorf("expected messages after a 13-character label field, got column %d", column)
+	}
+	if !strings.Contains(out, "        error: first message\n") {
+		t.Errorf("expected right-aligned error label, got %q", out)
+	}
+
+	out, _ = reporter.WithAlignLabels(false).FormatAs(FormatFehler, ds[:1])
+	if !strings.HasPrefix(out, "error: first message\n") {
+		t.Errorf("expected unpadded label by default, got %q", out)
+	}
+}
+
+func TestWithRelatedRange(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("main.go", "package main\n\nvar x = 1\nvar x = 2\n")
+
+	d := NewDiagnosticWithLocation(SeverityError, "x redeclared", "main.go", 4, 5).
+		WithRelatedRange(NewSourceRangeSingle("main.go", 3, 5))
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{d})
+
+	if strings.Contains(out, "↳") {
+		t.Errorf("did not expect a label prefix for a related range without message, got %q", out)
+	}
+	if strings.Count(out, "  main.go:3:5\n") != 1 {
+		t.Errorf("expected the related range's location, got %q", out)
+	}
+	if strings.Count(out, "   3 | var x = 1\n") != 2 {
+		t.Errorf("expected the related snippet after the primary one, got %q", out)
+	}
+
+	d = NewDiagnosticWithLocation(SeverityError, "x redeclared", "main.go", 4, 5).
+		WithRelated(NewSourceRangeSingle("main.go", 3, 5), "previous declaration")
+	out, _ = reporter.FormatAs(FormatFehler, []*Diagnostic{d})
+	if !strings.Contains(out, "  ↳  previous declaration\n  main.go:3:5\n") {
+		t.Errorf("expected related message before its snippet, got %q", out)
+	}
+}
+
+func TestSarifRelatedLocations(t *testing.T) {
+	d := NewDiagnosticWithLocation(SeverityError, "x redeclared", "main.go", 4, 5).
+		WithRelatedRange(NewSourceRangeSingle("main.go", 3, 5)).
+		WithRelated(NewSourceRangeSingle("other.go", 1, 5), "also here")
+
+	var buf bytes.Buffer
+	if err := EmitSarif([]*Diagnostic{d}, &buf); err != nil {
+		t.Fatalf("EmitSarif failed: %v", err)
+	}
+	report, err := ParseSarif(&buf)
+	if err != nil {
+		t.Fatalf("ParseSarif failed: %v", err)
+	}
+	res := report.Runs[0].Results[0]
+	if len(res.RelatedLocations) != 2 {
+		t.Fatalf("expected 2 related locations, got %+v", res.RelatedLocations)
+	}
+	if msg := res.RelatedLocations[0].Message; msg == nil || msg.Text != "" {
+		t.Errorf("expected an empty message for a related range, got %+v", msg)
+	}
+	if msg := res.RelatedLocations[1].Message; msg == nil || msg.Text != "also here" {
+		t.Errorf("expected related message, got %+v", msg)
+	}
+	if res.Locations[0].Message != nil {
+		t.Error("did not expect a message on the primary location")
+	}
+}
+
+func TestWithInlineSource(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	d := NewDiagnosticWithRange(SeverityError, "unexpected token", "<repl>", 2, 9, 2, 10).
+		WithInlineSource("let a = 1\nlet b = ))\n")
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{d})
+	expected := "  <repl>:2:9\n" +
+		"     1 | let a = 1\n" +
+		"     2 | let b = ))\n" +
+		"                 ~~\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected snippet from inline source\nexpected:\n%s\ngot:\n%s", expected, out)
+	}
+	if len(reporter.Sources) != 0 {
+		t.Errorf("expected inline source not to be registered, got %v", reporter.Sources)
+	}
+	if errs := reporter.Validate([]*Diagnostic{d}); len(errs) != 0 {
+		t.Errorf("expected inline source to pass validation, got %v", errs)
+	}
+
+	out, _ = reporter.FormatAs(FormatFehler, []*Diagnostic{NewDiagnosticWithLocation(SeverityError, "other", "<repl>", 1, 1)})
+	if strings.Contains(out, " | ") {
+		t.Errorf("expected inline source to stay with its diagnostic, got %q", out)
+	}
+}
+
+func TestFormattedMessage(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithMessageCatalog(func(locale, key string) string {
+		if locale != "fr" {
+			return ""
+		}
+		switch key {
+		case "syntax error":
+			return "erreur de syntaxe"
+		case "unused variable %q":
+			return "variable inutilisée %q"
+		}
+		return ""
+	})
+
+	d := NewDiagnostic(SeverityError, "syntax error").WithMessageLocale("fr")
+	if got := reporter.FormattedMessage(d); got != "erreur de syntaxe" {
+		t.Errorf("expected French translation, got %q", got)
+	}
+	if got := reporter.FormattedMessage(NewDiagnostic(SeverityWarning, "unused variable %q").WithArgs("x").WithMessageLocale("fr")); got != `variable inutilisée "x"` {
+		t.Errorf("expected translated message with arguments, got %q", got)
+	}
+	if got := reporter.FormattedMessage(NewDiagnostic(SeverityError, "type mismatch").WithMessageLocale("fr")); got != "type mismatch" {
+		t.Errorf("expected fallback for missing translation, got %q", got)
+	}
+	if got := reporter.FormattedMessage(NewDiagnostic(SeverityError, "syntax error")); got != "syntax error" {
+		t.Errorf("expected English without a locale, got %q", got)
+	}
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{d})
+	if !strings.HasPrefix(out, "error: erreur de syntaxe\n") {
+		t.Errorf("expected rendered output to use the translation, got %q", out)
+	}
+
+	other, _ := NewErrorReporter().WithNoColor(true).FormatAs(FormatFehler, []*Diagnostic{d})
+	if !strings.HasPrefix(other, "error: syntax error\n") {
+		t.Errorf("expected a reporter without a catalog to leave the message untranslated, got %q", other)
+	}
+}
+
+func TestZeroBasedLines(t *testing.T) {
+	source := "package main\n\nfunc main() {\n\tbad()\n}\n"
+	d := NewDiagnosticWithRange(SeverityError, "undefined: bad", "main.go", 4, 2, 4, 4)
+
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("main.go", source)
+	oneBased, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{d})
+	zeroBased, _ := reporter.WithZeroBasedLines(true).FormatAs(FormatFehler, []*Diagnostic{d})
+
+	expected := "  main.go:3:2\n" +
+		"  ...\n" +
+		"     1 | \n" +
+		"     2 | func main() {\n" +
+		"     3 | \tbad()\n" +
+		"          ~~~\n" +
+		"     4 | }\n"
+	if !strings.Contains(zeroBased, expected) {
+		t.Errorf("expected 0-based numbers with the same underline\nexpected:\n%s\ngot:\n%s", expected, zeroBased)
+	}
+	if !strings.Contains(oneBased, "  main.go:4:2\n") || !strings.Contains(oneBased, "     4 | \tbad()\n          ~~~\n") {
+		t.Errorf("expected 1-based numbers by default, got %q", oneBased)
+	}
+
+	if literal, _ := (&ErrorReporter{NoColor: true}).FormatAs(FormatGCC, []*Diagnostic{d}); !strings.HasPrefix(literal, "main.go:4:2: ") {
+		t.Errorf("expected a zero ErrorReporter to show 1-based numbers, got %q", literal)
+	}
+
+	gcc, _ := reporter.FormatAs(FormatGCC, []*Diagnostic{d})
+	msvc, _ := reporter.FormatAs(FormatMSVC, []*Diagnostic{d})
+	if !strings.HasPrefix(gcc, "main.go:3:2: ") || !strings.HasPrefix(msvc, "main.go(3, 2): ") {
+		t.Errorf("expected 0-based headers, got %q and %q", gcc, msvc)
+	}
+	if d.Range.Start.Line != 4 {
+		t.Errorf("expected the range itself to stay 1-based, got line %d", d.Range.Start.Line)
+	}
+}
+
+func TestBuildSarifReport(t *testing.T) {
+	d := NewDiagnosticWithRange(SeverityError, "bad thing", "main.go", 1, 1, 1, 4).WithCode("E001")
+
+	report := BuildSarifReport([]*Diagnostic{d})
+	if len(report.Runs) != 1 || len(report.Runs[0].Results) != 1 {
+		t.Fatalf("expected one run with one result, got %+v", report.Runs)
+	}
+	report.Runs[0].Tool.Driver.Name = "mylinter"
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(report); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"name":"mylinter"`) {
+		t.Errorf("expected mutated driver name in JSON, got %s", buf.String())
+	}
+
+	var emitted bytes.Buffer
+	if err := EmitSarif([]*Diagnostic{d}, &emitted); err != nil {
+		t.Fatalf("EmitSarif failed: %v", err)
+	}
+	parsed, err := ParseSarif(&emitted)
+	if err != nil {
+		t.Fatalf("ParseSarif failed: %v", err)
+	}
+	if parsed.Runs[0].Tool.Driver.Name != "fehler" {
+		t.Errorf("expected EmitSarif to keep the default driver name, got %q", parsed.Runs[0].Tool.Driver.Name)
+	}
+}
+
+func TestReportManyWithResult(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithDisabledSeverities(SeverityNote)
+
+	result := reporter.ReportManyWithResult([]*Diagnostic{
+		NewDiagnostic(SeverityWarning, "unused variable"),
+		NewDiagnostic(SeverityNote, "filtered out"),
+		NewDiagnostic(SeverityError, "hidden").Suppress(),
+		NewDiagnostic(SeverityWarning, "shadowed import"),
+	})
+	if result.Printed != 2 || result.Suppressed != 1 || result.HadErrors || result.Stopped {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if result.Counts[SeverityWarning] != 2 || result.Counts[SeverityNote] != 0 || result.Counts[SeverityError] != 0 {
+		t.Errorf("unexpected counts: %v", result.Counts)
+	}
+
+	result = reporter.WithStopOnFatal(true).ReportManyWithResult([]*Diagnostic{
+		NewDiagnostic(SeverityError, "type mismatch"),
+		NewDiagnostic(SeverityFatal, "cannot continue"),
+		NewDiagnostic(SeverityWarning, "never reached"),
+	})
+	if result.Printed != 2 || !result.HadErrors || !result.Stopped {
+		t.Errorf("unexpected result after StopOnFatal: %+v", result)
+	}
+	if result.Counts[SeverityWarning] != 0 || result.Counts[SeverityFatal] != 1 {
+		t.Errorf("expected counts for this call only, got %v", result.Counts)
+	}
+	if total := reporter.CountBySeverity()[SeverityWarning]; total != 2 {
+		t.Errorf("expected reporter totals to keep accumulating, got %d warnings", total)
+	}
+}
+
+func TestSourceRangeCanonicalize(t *testing.T) {
+	valid := NewSourceRangeSpan("main.go", 2, 3, 4, 5)
+	if got := valid.Canonicalize(); got != valid {
+		t.Errorf("expected a valid range unchanged, got %v", got)
+	}
+
+	swapped := NewSourceRangeSpan("main.go", 4, 5, 2, 3).Canonicalize()
+	if swapped.Start != (Position{2, 3}) || swapped.End != (Position{4, 5}) {
+		t.Errorf("expected inverted range to be swapped, got %v", swapped)
+	}
+
+	clamped := NewSourceRangeSpan("main.go", 0, -2, 3, 0).Canonicalize()
+	if clamped.Start != (Position{1, 1}) || clamped.End != (Position{3, 1}) {
+		t.Errorf("expected positions clamped to 1, got %v", clamped)
+	}
+
+	zeroEnd := SourceRange{File: "main.go", Start: Position{3, 7}}.Canonicalize()
+	if zeroEnd.End != zeroEnd.Start || zeroEnd.Start != (Position{3, 7}) {
+		t.Errorf("expected zero End to be set to Start, got %v", zeroEnd)
+	}
+}
+
+func TestReportCanonicalizesRange(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.AddSource("main.go", "let x = 1;\nlet y = z;\n")
+
+	r := NewSourceRangeSpan("main.go", 2, 10, 2, 9)
+	reporter.Report(NewDiagnostic(SeverityError, "unknown name").WithRange(r))
+
+	if !strings.Contains(buf.String(), "main.go:2:9") || !strings.Contains(buf.String(), "                ~~\n") {
+		t.Errorf("expected the inverted range to render as 2:9-2:10, got:\n%s", buf.String())
+	}
+	if r.Start.Column != 10 {
+		t.Errorf("expected the caller's range to be left alone")
+	}
+}
+
+func TestSuggestionDiff(t *testing.T) {
+	source := "let x = 1;\nlet y = z;\n"
+	d := NewDiagnosticWithRange(SeverityError, "unknown name", "main.go", 2, 9, 2, 9).
+		WithSuggestion(NewSourceRangeSingle("main.go", 2, 9), "x")
+
+	plain := NewErrorReporter().WithNoColor(true).WithSuggestionDiff()
+	plain.AddSource("main.go", source)
+	out, _ := plain.FormatAs(FormatFehler, []*Diagnostic{d})
+	expected := "  suggestion: main.go:2:9\n    - let y = z;\n    + let y = x;\n"
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected plain diff hunk %q, got:\n%s", expected, out)
+	}
+
+	colored := NewErrorReporter().WithNoColor(false).WithSuggestionDiff()
+	colored.AddSource("main.go", source)
+	out, _ = colored.FormatAs(FormatFehler, []*Diagnostic{d})
+	if !strings.Contains(out, colorRed+"- let y = z;"+colorReset) || !strings.Contains(out, colorGreen+"+ let y = x;"+colorReset) {
+		t.Errorf("expected red removed and green inserted lines, got %q", out)
+	}
+
+	off, _ := NewErrorReporter().WithNoColor(true).FormatAs(FormatFehler, []*Diagnostic{d})
+	if strings.Contains(off, "suggestion:") {
+		t.Errorf("expected no diff unless enabled, got:\n%s", off)
+	}
+}
+
+func TestOnFirstError(t *testing.T) {
+	var calls []string
+	reporter := NewErrorReporter().WithWriter(io.Discard).WithOnFirstError(func(d *Diagnostic) {
+		calls = append(calls, d.Message)
+	})
+
+	reporter.Report(NewDiagnostic(SeverityWarning, "unused import"))
+	reporter.Report(NewDiagnostic(SeverityError, "hidden").Suppress())
+	reporter.Report(NewDiagnostic(SeverityError, "first error"))
+	reporter.Report(NewDiagnostic(SeverityWarning, "unused variable"))
+	reporter.ReportMany([]*Diagnostic{
+		NewDiagnostic(SeverityError, "second error"),
+		NewDiagnostic(SeverityFatal, "third error"),
+	})
+
+	if len(calls) != 1 || calls[0] != "first error" {
+		t.Errorf("expected one call with the first error, got %q", calls)
+	}
+}
+
+func TestSeveritySuccess(t *testing.T) {
+	if SeveritySuccess.Label() != "ok" || SeveritySuccess.Color() != colorGreen {
+		t.Errorf("expected label \"ok\" in green, got %q %q", SeveritySuccess.Label(), SeveritySuccess.Color())
+	}
+	if sarifLevel(SeveritySuccess) != "none" {
+		t.Errorf("expected SARIF level none, got %q", sarifLevel(SeveritySuccess))
+	}
+	report := BuildSarifReport([]*Diagnostic{NewDiagnostic(SeveritySuccess, "clean"), NewDiagnostic(SeverityWarning, "dirty")})
+	if results := report.Runs[0].Results; results[0].Kind != "pass" || results[1].Kind != "fail" {
+		t.Errorf("expected kinds pass and fail, got %q and %q", results[0].Kind, results[1].Kind)
+	}
+	report.Runs[0].Results[0].Properties = nil
+	if ds := DiagnosticsFromSarif(*report); ds[0].Severity != SeveritySuccess {
+		t.Errorf("expected a pass result to decode as success, got %v", ds[0].Severity)
+	}
+
+	d := NewDiagnostic(SeveritySuccess, "no issues in foo.go")
+	plain, _ := NewErrorReporter().WithNoColor(true).FormatAs(FormatFehler, []*Diagnostic{d})
+	if !strings.HasPrefix(plain, "ok: no issues in foo.go\n") {
+		t.Errorf("expected an ok header, got %q", plain)
+	}
+	colored, _ := NewErrorReporter().WithNoColor(false).FormatAs(FormatFehler, []*Diagnostic{d})
+	if !strings.Contains(colored, colorGreen) || !strings.Contains(colored, "ok") {
+		t.Errorf("expected a green ok label, got %q", colored)
+	}
+}
+
+func TestSourceRangeContainsRange(t *testing.T) {
+	parent := NewSourceRangeSpan("main.go", 2, 1, 6, 1)
+	tests := []struct {
+		name  string
+		outer SourceRange
+		inner SourceRange
+		want  bool
+	}{
+		{"itself", parent, parent, true},
+		{"nested", parent, NewSourceRangeSpan("main.go", 3, 5, 4, 2), true},
+		{"shared start", parent, NewSourceRangeSpan("main.go", 2, 1, 2, 9), true},
+		{"shared end", parent, NewSourceRangeSpan("main.go", 5, 1, 6, 1), true},
+		{"starts before", parent, NewSourceRangeSpan("main.go", 1, 9, 3, 1), false},
+		{"ends after", parent, NewSourceRangeSpan("main.go", 3, 1, 6, 2), false},
+		{"other file", parent, NewSourceRangeSpan("other.go", 3, 1, 4, 1), false},
+		{"single char itself", NewSourceRangeSingle("main.go", 3, 4), NewSourceRangeSingle("main.go", 3, 4), true},
+		{"single char neighbour", NewSourceRangeSingle("main.go", 3, 4), NewSourceRangeSingle("main.go", 3, 5), false},
+		{"single char widened", NewSourceRangeSingle("main.go", 3, 4), NewSourceRangeSpan("main.go", 3, 4, 3, 5), false},
+		{"empty itself", SourceRange{File: "main.go"}, SourceRange{File: "main.go"}, true},
+		{"empty and char", SourceRange{File: "main.go"}, NewSourceRangeSingle("main.go", 1, 1), false},
+	}
+	for _, tt := range tests {
+		if got := tt.outer.ContainsRange(tt.inner); got != tt.want {
+			t.Errorf("%s: ContainsRange(%v, %v) = %v, want %v", tt.name, tt.outer, tt.inner, got, tt.want)
+		}
+	}
+}
+
+func TestFormatMessageOnly(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("main.go", "let x = 1;\n")
+	ds := []*Diagnostic{
+		NewDiagnosticWithRange(SeverityError, "type mismatch", "main.go", 1, 5, 1, 5).
+			WithCode("E0001").
+			WithHelp("add a cast"),
+		NewDiagnosticWithLocation(SeverityWarning, "unused variable", "main.go", 1, 5),
+		NewDiagnostic(SeverityNote, "no location"),
+	}
+
+	out, err := reporter.FormatAs(FormatMessageOnly, ds)
+	if err != nil {
+		t.Fatalf("FormatAs failed: %v", err)
+	}
+	expected := "error[E0001]: type mismatch\nwarning: unused variable\nnote: no location\n"
+	if out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestFileFilter(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithFileFilter(FileFilterPrefix("pkg/"))
+
+	reporter.ReportMany([]*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "in pkg", "pkg/a.go", 1, 1),
+		NewDiagnosticWithLocation(SeverityError, "in cmd", "cmd/b.go", 1, 1),
+		NewDiagnostic(SeverityWarning, "no range"),
+	})
+
+	out := buf.String()
+	if !strings.Contains(out, "in pkg") || strings.Contains(out, "in cmd") || !strings.Contains(out, "no range") {
+		t.Errorf("expected only pkg/ and range-less diagnostics, got:\n%s", out)
+	}
+	if n := reporter.CountBySeverity()[SeverityError]; n != 1 {
+		t.Errorf("expected filtered diagnostics not to be counted, got %d errors", n)
+	}
+}
+
+func TestSingleCharLabelConnector(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.AddSource("main.go", "let x = y;\n")
+
+	reporter.Report(NewDiagnostic(SeverityError, "unknown name").
+		WithRange(NewSourceRangeSingle("main.go", 1, 9).WithLabel("here")).
+		WithSecondaryRange(NewSourceRangeSpan("main.go", 1, 5, 1, 5).WithLabel("bound here")).
+		WithSecondaryRange(NewSourceRangeSpan("main.go", 1, 1, 1, 3).WithLabel("keyword")))
+
+	out := buf.String()
+	if !strings.Contains(out, "\n"+strings.Repeat(" ", 9)+"        ^-- here\n") {
+		t.Errorf("expected the label joined to the caret at column 9, got:\n%s", out)
+	}
+	if !strings.Contains(out, "\n"+strings.Repeat(" ", 9)+"    ^-- bound here\n") {
+		t.Errorf("expected the secondary caret label at column 5, got:\n%s", out)
+	}
+	if !strings.Contains(out, "\n"+strings.Repeat(" ", 9)+"~~~ keyword\n") {
+		t.Errorf("expected multi-character spans to keep a plain space, got:\n%s", out)
+	}
+}
+
+func TestWithContextMessage(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.Report(NewDiagnostic(SeverityError, "type mismatch").WithContextMessage("while compiling function 'foo'"))
+
+	if !strings.HasPrefix(buf.String(), "  context: while compiling function 'foo'\nerror: type mismatch\n") {
+		t.Errorf("expected the context line before the header, got %q", buf.String())
+	}
+
+	colored, _ := NewErrorReporter().WithNoColor(false).FormatAs(FormatFehler, []*Diagnostic{
+		NewDiagnostic(SeverityError, "type mismatch").WithContextMessage("in foo"),
+	})
+	if !strings.HasPrefix(colored, "  "+colorDim+colorWhite+"context: in foo"+colorReset+"\n") {
+		t.Errorf("expected a dim white context line, got %q", colored)
+	}
+}
+
+func TestBareFastPathMatchesFullPrinters(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true).WithMessagePrefix("[lint] ").WithAlignLabels(true)
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityError, "plain message"),
+		NewDiagnostic(SeverityWarning, "formatted %d").WithArgs(42),
+		NewDiagnostic(SeverityNote, "hidden").Suppress(),
+	}
+	printers := map[OutputFormat]func(*renderer, *Diagnostic){
+		FormatFehler: (*renderer).printFehler,
+		FormatGCC:    (*renderer).printGcc,
+	}
+	for format, slow := range printers {
+		for _, d := range ds {
+			var fast, full bytes.Buffer
+			r := reporter.newRenderer(&fast, format)
+			if !r.isBare(d) {
+				t.Fatalf("expected %q to take the fast path", d.Message)
+			}
+			r.render(d)
+			slow(reporter.newRenderer(&full, format), d)
+			if fast.String() != full.String() {
+				t.Errorf("format %d: fast path %q differs from full printer %q", format, fast.String(), full.String())
+			}
+		}
+	}
+
+	colored := NewErrorReporter().WithNoColor(false)
+	if colored.newRenderer(io.Discard, FormatFehler).isBare(ds[0]) {
+		t.Error("expected colored output to skip the fast path")
+	}
+	if reporter.newRenderer(io.Discard, FormatFehler).isBare(NewDiagnostic(SeverityError, "x").WithHelp("y")) {
+		t.Error("expected diagnostics with help to skip the fast path")
+	}
+}
+
+func BenchmarkReportBare(b *testing.B) {
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(io.Discard)
+	d := NewDiagnostic(SeverityWarning, "unused variable")
+
+	b.Run("fast", func(b *testing.B) {
+		r := reporter.newRenderer(io.Discard, FormatFehler)
+		b.ReportAllocs()
+		for b.Loop() {
+			r.render(d)
+		}
+	})
+	b.Run("printf", func(b *testing.B) {
+		r := reporter.newRenderer(io.Discard, FormatFehler)
+		b.ReportAllocs()
+		for b.Loop() {
+			r.printFehler(d)
+		}
+	})
+}
+
+func TestAddSources(t *testing.T) {
+	reporter := NewErrorReporter()
+	reporter.AddSources(map[string]string{"a.go": "package a\n", "b.go": "package b\n"})
+	if !reporter.HasSource("a.go") || !reporter.HasSource("b.go") || reporter.HasSource("c.go") {
+		t.Errorf("expected exactly a.go and b.go, got %v", reporter.Sources)
+	}
+}
+
+func TestAddSourcesFromDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go":          "package main\n",
+		"sub/util.go":      "package sub\n",
+		"README.md":        "# readme\n",
+		"sub/testdata.txt": "data\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reporter := NewErrorReporter()
+	if err := reporter.AddSourcesFromDir(dir, ".go"); err != nil {
+		t.Fatalf("AddSourcesFromDir failed: %v", err)
+	}
+	if len(reporter.Sources) != 2 {
+		t.Errorf("expected only the two .go files, got %d sources", len(reporter.Sources))
+	}
+	for _, name := range []string{"main.go", "sub/util.go"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if !reporter.HasSource(path) || reporter.Sources[path] != files[name] {
+			t.Errorf("expected %s to be registered with its content", path)
+		}
+	}
+
+	if err := NewErrorReporter().AddSourcesFromDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestSourceRangeIntersects(t *testing.T) {
+	span := NewSourceRangeSpan("main.go", 2, 5, 4, 10)
+	tests := []struct {
+		name string
+		a, b SourceRange
+		want bool
+	}{
+		{"touching at one column", NewSourceRangeSpan("main.go", 1, 1, 1, 5), NewSourceRangeSpan("main.go", 1, 5, 1, 9), true},
+		{"adjacent", NewSourceRangeSpan("main.go", 1, 1, 1, 5), NewSourceRangeSpan("main.go", 1, 6, 1, 9), false},
+		{"overlapping lines", NewSourceRangeSpan("main.go", 1, 1, 1, 8), NewSourceRangeSpan("main.go", 1, 4, 1, 12), true},
+		{"overlapping multiline", span, NewSourceRangeSpan("main.go", 4, 1, 6, 1), true},
+		{"multiline touching end", span, NewSourceRangeSingle("main.go", 4, 10), true},
+		{"multiline past end", span, NewSourceRangeSingle("main.go", 4, 11), false},
+		{"multiline before start", span, NewSourceRangeSpan("main.go", 1, 1, 2, 4), false},
+		{"nested", span, NewSourceRangeSingle("main.go", 3, 80), true},
+		{"disjoint", NewSourceRangeSingle("main.go", 1, 1), NewSourceRangeSingle("main.go", 9, 1), false},
+		{"inverted", NewSourceRangeSpan("main.go", 1, 8, 1, 1), NewSourceRangeSingle("main.go", 1, 3), true},
+		{"different files", span, NewSourceRangeSpan("other.go", 2, 5, 4, 10), false},
+	}
+	for _, tt := range tests {
+		if got, back := tt.a.Intersects(tt.b), tt.b.Intersects(tt.a); got != tt.want || back != tt.want {
+			t.Errorf("%s: Intersects = %v/%v, want %v", tt.name, got, back, tt.want)
+		}
+	}
+}
+
+func TestWithIcons(t *testing.T) {
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityFatal, "out of memory"),
+		NewDiagnostic(SeverityError, "type mismatch").WithCode("E001"),
+		NewDiagnostic(SeverityWarning, "unused variable"),
+		NewDiagnostic(SeverityNote, "declared here"),
+		NewDiagnostic(SeverityTodo, "handle errors"),
+		NewDiagnostic(SeverityUnimplemented, "generics"),
+	}
+
+	out, _ := NewErrorReporter().WithNoColor(true).WithIcons().FormatAs(FormatFehler, ds)
+	for _, want := range []string{
+		"✗ fatal: out of memory\n",
+		"✗ error[E001]: type mismatch\n",
+		"⚠ warning: unused variable\n",
+		"ℹ note: declared here\n",
+		"✓ todo: handle errors\n",
+		"✓ unimplemented: generics\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+
+	plain, _ := NewErrorReporter().WithNoColor(true).FormatAs(FormatFehler, ds)
+	if strings.ContainsAny(plain, "✗⚠ℹ✓") || !strings.HasPrefix(plain, "fatal: out of memory\n") {
+		t.Errorf("expected no icons by default, got:\n%s", plain)
+	}
+}
+
+func TestDedupeHelp(t *testing.T) {
+	newDiag := func(code, msg string) *Diagnostic {
+		return NewDiagnostic(SeverityWarning, msg).WithCode(code).WithHelp("help for " + code).WithUrl("https://example.com/" + code)
+	}
+	ds := []*Diagnostic{
+		newDiag("W001", "first"),
+		newDiag("W002", "other code"),
+		newDiag("W001", "second"),
+		newDiag("W001", "third"),
+	}
+
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithDedupeHelp(true)
+	reporter.ReportMany(ds)
+	out := buf.String()
+	if n := strings.Count(out, "help: help for W001"); n != 1 {
+		t.Errorf("expected W001 help once, got %d times:\n%s", n, out)
+	}
+	if n := strings.Count(out, "see: https://example.com/W001"); n != 1 {
+		t.Errorf("expected W001 url once, got %d times", n)
+	}
+	if n := strings.Count(out, "help: help for W002"); n != 1 {
+		t.Errorf("expected W002 help once, got %d times", n)
+	}
+	if n := strings.Count(out, "help: (see above)"); n != 2 {
+		t.Errorf("expected two see-above hints, got %d", n)
+	}
+
+	buf.Reset()
+	reporter.ReportMany(ds[:1])
+	if !strings.Contains(buf.String(), "help: help for W001") {
+		t.Errorf("expected help again in a new batch, got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	reporter.WithDedupeHelp(false).ReportMany(ds)
+	if n := strings.Count(buf.String(), "help: help for W001"); n != 3 {
+		t.Errorf("expected help on every diagnostic when disabled, got %d", n)
+	}
+}
+
+func TestNewSourceRangeLine(t *testing.T) {
+	r := NewSourceRangeLine("main.go", 3, "héllo")
+	if r.Start != (Position{3, 1}) || r.End != (Position{3, 5}) {
+		t.Errorf("expected 3:1-3:5, got %v", r)
+	}
+	if empty := NewSourceRangeLine("main.go", 2, ""); !empty.IsSingleChar() || empty.Start.Column != 1 {
+		t.Errorf("expected an empty line to give a single character at column 1, got %v", empty)
+	}
+
+	reporter := NewErrorReporter()
+	reporter.AddSource("main.go", "package main\r\nabcde\r\n")
+	r, err := reporter.NewSourceRangeForLine("main.go", 2)
+	if err != nil {
+		t.Fatalf("NewSourceRangeForLine failed: %v", err)
+	}
+	if r.Start.Column != 1 || r.End.Column != 5 || r.Start.Line != 2 || r.End.Line != 2 {
+		t.Errorf("expected 2:1-2:5, got %v", r)
+	}
+	if _, err := reporter.NewSourceRangeForLine("main.go", 9); err == nil {
+		t.Error("expected an error for a line past the end")
+	}
+	if _, err := reporter.NewSourceRangeForLine("other.go", 1); err == nil {
+		t.Error("expected an error for an unregistered file")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(false).WithFormat(FormatGCC)
+	reporter.AddSource("main.go", "let x = y;\n")
+	ds := []*Diagnostic{
+		NewDiagnosticWithLocation(SeverityError, "unknown name", "main.go", 1, 9).WithCode("E001"),
+		NewDiagnostic(SeverityWarning, "no location"),
+	}
+
+	expected, _ := reporter.FormatAs(FormatGCC, ds)
+	if got := reporter.Bytes(ds); string(got) != expected {
+		t.Errorf("expected Bytes to match FormatAs\nexpected: %q\ngot:      %q", expected, got)
+	}
+	if !bytes.Contains(reporter.Bytes(ds), []byte(colorRed)) {
+		t.Error("expected color codes when color is enabled")
+	}
+	if n := reporter.CountBySeverity()[SeverityError]; n != 0 {
+		t.Errorf("expected Bytes not to count diagnostics, got %d", n)
+	}
+}
+
+func TestAddFormat(t *testing.T) {
+	var fehlerOut, gccOut bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&fehlerOut).AddFormat(FormatGCC, &gccOut)
+	reporter.AddSource("main.go", "let x = y;\n")
+
+	reporter.Report(NewDiagnosticWithLocation(SeverityError, "unknown name", "main.go", 1, 9))
+	reporter.Report(NewDiagnostic(SeverityNote, "hidden").Suppress())
+
+	if !strings.HasPrefix(fehlerOut.String(), "error: unknown name\n  main.go:1:9\n") {
+		t.Errorf("expected Fehler output in the primary writer, got:\n%s", fehlerOut.String())
+	}
+	if gccOut.String() != "main.go:1:9: error: unknown name\n" {
+		t.Errorf("expected GCC output in the added writer, got %q", gccOut.String())
+	}
+	if n := reporter.CountBySeverity()[SeverityError]; n != 1 {
+		t.Errorf("expected the diagnostic to be counted once, got %d", n)
+	}
+}
+
+func TestSarifSeverityProperty(t *testing.T) {
+	var ds []*Diagnostic
+	for sev := SeverityFatal; sev <= SeveritySuccess; sev++ {
+		ds = append(ds, NewDiagnostic(sev, "message"))
+	}
+
+	var buf bytes.Buffer
+	if err := EmitSarif(ds, &buf); err != nil {
+		t.Fatalf("EmitSarif failed: %v", err)
+	}
+	report, err := ParseSarif(&buf)
+	if err != nil {
+		t.Fatalf("ParseSarif failed: %v", err)
+	}
+	for i, res := range report.Runs[0].Results {
+		if got := res.Properties["fehlerSeverity"]; got != ds[i].Severity.Label() {
+			t.Errorf("result %d: expected fehlerSeverity %q, got %v", i, ds[i].Severity.Label(), got)
+		}
+	}
+
+	for i, d := range DiagnosticsFromSarif(report) {
+		if d.Severity != ds[i].Severity {
+			t.Errorf("result %d: expected severity %v to round-trip, got %v", i, ds[i].Severity, d.Severity)
+		}
+	}
+}
+
+func TestPositionZeroBasedIndexes(t *testing.T) {
+	p := Position{Line: 3, Column: 7}
+	if p.LineIndex() != 2 || p.ColumnIndex() != 6 {
+		t.Errorf("expected indexes 2 and 6, got %d and %d", p.LineIndex(), p.ColumnIndex())
+	}
+	if z := p.ZeroBase(); z != (Position{2, 6}) {
+		t.Errorf("expected ZeroBase 2:6, got %v", z)
+	}
+
+	lines := []string{"a", "b", "c"}
+	if lines[p.LineIndex()] != "c" {
+		t.Errorf("expected LineIndex to index the third line")
+	}
+
+	for _, clamped := range []Position{{0, 0}, {-4, -1}} {
+		if clamped.LineIndex() != 0 || clamped.ColumnIndex() != 0 || clamped.ZeroBase() != (Position{}) {
+			t.Errorf("expected %v to clamp to 0, got %d, %d, %v", clamped, clamped.LineIndex(), clamped.ColumnIndex(), clamped.ZeroBase())
+		}
+	}
+}
+
+func TestRenderParts(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(false)
+	reporter.AddSource("main.go", "let x = y;\nlet z = x;\n")
+	d := NewDiagnosticWithLocation(SeverityError, "unknown name", "main.go", 1, 9).
+		WithCode("E001").
+		WithContextMessage("while checking main").
+		WithSecondaryRange(NewSourceRangeSingle("main.go", 2, 5)).
+		WithNotes("declared nowhere").
+		WithHelp("declare y first")
+
+	header, snippet, footer, err := reporter.RenderParts(d)
+	if err != nil {
+		t.Fatalf("RenderParts failed: %v", err)
+	}
+	if !strings.Contains(header, "context: while checking main") || !strings.Contains(header, "unknown name") || strings.Contains(header, "main.go") {
+		t.Errorf("unexpected header %q", header)
+	}
+	if !strings.Contains(snippet, "main.go") || strings.Contains(snippet, "help") {
+		t.Errorf("unexpected snippet %q", snippet)
+	}
+	if !strings.Contains(footer, "declare y first") || !strings.Contains(footer, "declared nowhere") {
+		t.Errorf("unexpected footer %q", footer)
+	}
+
+	expected, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{d})
+	if got := header + snippet + footer + "\n"; got != expected {
+		t.Errorf("expected parts to reassemble to FormatAs output\nexpected: %q\ngot:      %q", expected, got)
+	}
+
+	if _, _, _, err := reporter.RenderParts(nil); err == nil {
+		t.Error("expected an error for a nil diagnostic")
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf)
+	reporter.SetFormat(FormatGCC)
+
+	reporter.Report(NewDiagnosticWithLocation(SeverityError, "unknown name", "main.go", 1, 9))
+	if buf.String() != "main.go:1:9: error: unknown name\n" {
+		t.Errorf("expected GCC output after SetFormat, got %q", buf.String())
+	}
+}
+
+func TestOnError(t *testing.T) {
+	var errs []string
+	reporter := NewErrorReporter().WithWriter(io.Discard).WithOnError(func(d *Diagnostic) {
+		errs = append(errs, d.Message)
+	})
+
+	reporter.ReportMany([]*Diagnostic{
+		NewDiagnostic(SeverityFatal, "fatal"),
+		NewDiagnostic(SeverityError, "error"),
+		NewDiagnostic(SeverityWarning, "warning"),
+		NewDiagnostic(SeverityNote, "note"),
+		NewDiagnostic(SeverityTodo, "todo"),
+		NewDiagnostic(SeverityError, "suppressed").Suppress(),
+		NewDiagnostic(SeverityError, "again"),
+	})
+	if !slices.Equal(errs, []string{"fatal", "error", "again"}) {
+		t.Errorf("expected OnError for each error-level diagnostic, got %q", errs)
+	}
+
+	var bell bytes.Buffer
+	reporter = NewErrorReporter().WithWriter(io.Discard).WithOnError(RingBell(&bell))
+	reporter.Report(NewDiagnostic(SeverityWarning, "quiet"))
+	reporter.Report(NewDiagnostic(SeverityError, "loud"))
+	if bell.String() != "\a" {
+		t.Errorf("expected one bell, got %q", bell.String())
+	}
+}
+
+func TestRangeInLocation(t *testing.T) {
+	ds := []*Diagnostic{
+		NewDiagnosticWithRange(SeverityError, "span", "main.go", 1, 5, 1, 20),
+		NewDiagnosticWithRange(SeverityError, "multiline", "main.go", 1, 5, 3, 2),
+		NewDiagnosticWithLocation(SeverityError, "single", "main.go", 2, 7),
+	}
+
+	out, _ := NewErrorReporter().WithNoColor(true).WithRangeInLocation().FormatAs(FormatFehler, ds)
+	for _, want := range []string{"  main.go:1:5-20\n", "  main.go:1:5 - 3:2\n", "  main.go:2:7\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected location %q, got:\n%s", want, out)
+		}
+	}
+
+	plain, _ := NewErrorReporter().WithNoColor(true).FormatAs(FormatFehler, ds[:2])
+	if strings.Count(plain, "  main.go:1:5\n") != 2 {
+		t.Errorf("expected only start positions by default, got:\n%s", plain)
+	}
+}
+
+func TestMinSeverityHiddenCount(t *testing.T) {
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityError, "type mismatch"),
+		NewDiagnostic(SeverityWarning, "unused variable"),
+		NewDiagnostic(SeverityNote, "declared here"),
+		NewDiagnostic(SeverityWarning, "unused import"),
+	}
+
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithMinSeverity(SeverityError)
+	result := reporter.ReportManyWithResult(ds)
+
+	if result.Printed != 1 || result.Hidden[SeverityWarning] != 2 || result.Hidden[SeverityNote] != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	out := buf.String()
+	if strings.Contains(out, "unused") || !strings.Contains(out, "type mismatch") {
+		t.Errorf("expected only the error to be printed, got:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "\n2 warnings, 1 note hidden (raise verbosity to show)\n") {
+		t.Errorf("expected a trailing hidden count, got:\n%s", out)
+	}
+
+	buf.Reset()
+	reporter.WithShowHiddenCount(false).ReportMany(ds)
+	if strings.Contains(buf.String(), "hidden") {
+		t.Errorf("expected no hidden count when disabled, got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	NewErrorReporter().WithNoColor(true).WithWriter(&buf).ReportMany(ds)
+	if strings.Contains(buf.String(), "hidden") || strings.Count(buf.String(), "unused") != 2 {
+		t.Errorf("expected everything shown without MinSeverity, got:\n%s", buf.String())
+	}
+}
+
+func TestDiagnosticApproxEquals(t *testing.T) {
+	want := NewDiagnosticWithRange(SeverityError, "type mismatch", "main.go", 3, 5, 3, 9).WithCode("E001")
+	shifted := NewDiagnosticWithRange(SeverityError, "type mismatch", "main.go", 3, 6, 3, 10).WithCode("E001")
+
+	if !want.Equal(NewDiagnosticWithRange(SeverityError, "type mismatch", "main.go", 3, 5, 3, 9).WithCode("E001")) {
+		t.Error("expected identical diagnostics to be Equal")
+	}
+	if want.ApproxEquals(shifted, 0) || want.Equal(shifted) {
+		t.Error("expected a one-column shift to be rejected with tolerance 0")
+	}
+	if !want.ApproxEquals(shifted, 1) || !shifted.ApproxEquals(want, 1) {
+		t.Error("expected a one-column shift to be accepted with tolerance 1")
+	}
+	if !want.ApproxEqualsLine(NewDiagnosticWithRange(SeverityError, "type mismatch", "main.go", 3, 40, 3, 80).WithCode("E001")) {
+		t.Error("expected ApproxEqualsLine to ignore columns")
+	}
+
+	for name, other := range map[string]*Diagnostic{
+		"line":     NewDiagnosticWithRange(SeverityError, "type mismatch", "main.go", 4, 5, 4, 9).WithCode("E001"),
+		"file":     NewDiagnosticWithRange(SeverityError, "type mismatch", "other.go", 3, 5, 3, 9).WithCode("E001"),
+		"message":  NewDiagnosticWithRange(SeverityError, "other", "main.go", 3, 5, 3, 9).WithCode("E001"),
+		"severity": NewDiagnosticWithRange(SeverityWarning, "type mismatch", "main.go", 3, 5, 3, 9).WithCode("E001"),
+		"code":     NewDiagnosticWithRange(SeverityError, "type mismatch", "main.go", 3, 5, 3, 9),
+		"no range": NewDiagnostic(SeverityError, "type mismatch").WithCode("E001"),
+	} {
+		if want.ApproxEquals(other, 100) || want.ApproxEqualsLine(other) {
+			t.Errorf("expected a different %s to never match", name)
+		}
+	}
+}
+
+func TestWithLabeledRange(t *testing.T) {
+	r := NewSourceRangeSpan("main.go", 1, 5, 1, 7)
+	d := NewDiagnostic(SeverityError, "unknown name").WithLabeledRange(r, "not declared")
+
+	if d.Range == nil || d.Range.Start != r.Start || d.Range.End != r.End || d.Range.File != "main.go" {
+		t.Fatalf("expected the range to be set, got %v", d.Range)
+	}
+	if d.Range.Label != "not declared" {
+		t.Errorf("expected the label to be set, got %q", d.Range.Label)
+	}
+	if r.Label != "" {
+		t.Errorf("expected the caller's range to be left alone, got label %q", r.Label)
+	}
+
+	out, _ := NewErrorReporter().WithNoColor(true).FormatAs(FormatFehler, []*Diagnostic{
+		d.WithInlineSource("let abc = 1;\n"),
+	})
+	if !strings.Contains(out, "~~~ not declared\n") {
+		t.Errorf("expected the label beside the underline, got:\n%s", out)
+	}
+}
+
+func TestProgressOutput(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).WithProgressOutput(50 * time.Millisecond)
+	defer reporter.StopProgress()
+
+	for i := range 3 {
+		reporter.Report(NewDiagnostic(SeverityWarning, fmt.Sprintf("warning %d", i)))
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	reporter.StopProgress()
+
+	out := buf.String()
+	if n := strings.Count(out, " diagnostics so far]\n"); n < 2 {
+		t.Errorf("expected at least two progress lines, got %d:\n%s", n, out)
+	}
+	if !regexp.MustCompile(`(?m)^\[progress: [1-3] diagnostics so far\]$`).MatchString(out) {
+		t.Errorf("expected progress lines with the running count, got:\n%s", out)
+	}
+
+	before := buf.Len()
+	time.Sleep(120 * time.Millisecond)
+	if buf.Len() != before {
+		t.Errorf("expected no output after StopProgress, got %q", buf.String()[before:])
+	}
+	reporter.StopProgress()
+}
+
+func TestIconStyles(t *testing.T) {
+	ds := []*Diagnostic{
+		NewDiagnostic(SeverityError, "type mismatch"),
+		NewDiagnostic(SeverityWarning, "unused variable"),
+		NewDiagnostic(SeverityNote, "declared here"),
+	}
+
+	emoji, _ := NewErrorReporter().WithNoColor(true).WithIconStyle(IconStyleEmoji).FormatAs(FormatFehler, ds)
+	for _, want := range []string{"❌ error: type mismatch\n", "⚠️ warning: unused variable\n", "💡 note: declared here\n"} {
+		if !strings.Contains(emoji, want) {
+			t.Errorf("expected %q, got:\n%s", want, emoji)
+		}
+	}
+
+	ascii, _ := NewErrorReporter().WithNoColor(true).WithIconStyle(IconStyleASCII).FormatAs(FormatFehler, ds)
+	for _, want := range []string{"[x] error: type mismatch\n", "[!] warning: unused variable\n", "[i] note: declared here\n"} {
+		if !strings.Contains(ascii, want) {
+			t.Errorf("expected %q, got:\n%s", want, ascii)
+		}
+	}
+
+	// With aligned labels, every message starts in the same terminal column.
+	for _, style := range []IconStyle{IconStyleSymbol, IconStyleEmoji, IconStyleASCII} {
+		out, _ := NewErrorReporter().WithNoColor(true).WithIconStyle(style).WithAlignLabels(true).FormatAs(FormatFehler, ds)
+		lines := strings.Split(out, "\n\n")
+		columns := map[int]bool{}
+		for i, d := range ds {
+			ic := style.icon(d.Severity)
+			rest, ok := strings.CutPrefix(lines[i], ic.text)
+			if !ok {
+				t.Fatalf("style %d: expected %q to start with %q", style, lines[i], ic.text)
+			}
+			columns[ic.width+strings.Index(rest, ": ")] = true
+		}
+		if len(columns) != 1 {
+			t.Errorf("style %d: expected aligned messages, got columns %v in:\n%s", style, columns, out)
+		}
+	}
+}
+
+func TestTemplateCatalog(t *testing.T) {
+	catalog := make(TemplateCatalog)
+	if err := catalog.Register(DiagnosticTemplate{
+		Code:     "E0308",
+		Message:  "mismatched types: expected %s, found %s",
+		Severity: SeverityError,
+		HelpFmt:  "convert the value to %[1]s",
+		URL:      "https://example.com/E0308",
+	}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := catalog.Register(DiagnosticTemplate{Code: "W0001", Message: "unused variable %q", Severity: SeverityWarning}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	mismatch, ok := catalog.Lookup("E0308")
+	if !ok {
+		t.Fatal("expected E0308 to be registered")
+	}
+	d := mismatch.New("int", "string")
+	if d.Message != "mismatched types: expected int, found string" || *d.Code != "E0308" || d.Severity != SeverityError {
+		t.Errorf("unexpected diagnostic: %+v", d)
+	}
+	if d.Help == nil || *d.Help != "convert the value to int" || d.Url == nil || *d.Url != "https://example.com/E0308" {
+		t.Errorf("expected formatted help and URL, got %v %v", d.Help, d.Url)
+	}
+
+	unused, _ := catalog.Lookup("W0001")
+	w := unused.New("x")
+	if w.Message != `unused variable "x"` || *w.Code != "W0001" || w.Help != nil || w.Url != nil {
+		t.Errorf("unexpected diagnostic: %+v", w)
+	}
+
+	if err := catalog.Register(DiagnosticTemplate{Code: "W0001"}); err == nil {
+		t.Error("expected an error for a duplicate code")
+	}
+	if err := catalog.Register(DiagnosticTemplate{Message: "no code"}); err == nil {
+		t.Error("expected an error for a missing code")
+	}
+	if _, ok := catalog.Lookup("E9999"); ok {
+		t.Error("expected an unknown code to be missing")
+	}
+}
+
+func TestSourceRangeEncode(t *testing.T) {
+	ranges := []SourceRange{
+		NewSourceRangeSpan("main.go", 1, 2, 3, 4),
+		NewSourceRangeSingle("src/lib-util.rs", 10, 5),
+		NewSourceRangeSpan(`C:\path\to\main.go`, 12, 1, 12, 80),
+		NewSourceRangeSpan("file:///tmp/a.go", 2, 3, 2, 9),
+		{File: "", Start: Position{1, 1}, End: Position{1, 1}},
+	}
+	for _, r := range ranges {
+		encoded := r.Encode()
+		parsed, err := ParseSourceRange(encoded)
+		if err != nil {
+			t.Errorf("ParseSourceRange(%q) failed: %v", encoded, err)
+			continue
+		}
+		if parsed != r {
+			t.Errorf("expected %q to round-trip to %+v, got %+v", encoded, r, parsed)
+		}
+	}
+
+	if got := NewSourceRangeSpan(`C:\path`, 1, 2, 3, 4).Encode(); got != `C:\path:1:2-3:4` {
+		t.Errorf("unexpected encoding %q", got)
+	}
+	for _, bad := range []string{"", "main.go", "main.go:1:2", "main.go:1:2:3:4", "main.go:x:2-3:4", "main.go:1:2-3:"} {
+		if _, err := ParseSourceRange(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestEndOfLineRange(t *testing.T) {
+	reporter := NewErrorReporter().WithNoColor(true)
+	reporter.AddSource("main.go", "let x = 10\n\nlet é = 1\r\n")
+
+	r, err := reporter.EndOfLineRange("main.go", 1)
+	if err != nil {
+		t.Fatalf("EndOfLineRange failed: %v", err)
+	}
+	if r.Start != (Position{1, 11}) || !r.IsSingleChar() {
+		t.Errorf("expected a single character at 1:11, got %v", r)
+	}
+	if r, _ := reporter.EndOfLineRange("main.go", 2); r.Start.Column != 1 {
+		t.Errorf("expected column 1 on an empty line, got %v", r)
+	}
+	if r, _ := reporter.EndOfLineRange("main.go", 3); r.Start.Column != 10 {
+		t.Errorf("expected runes and no carriage return to be counted, got %v", r)
+	}
+	if _, err := reporter.EndOfLineRange("main.go", 7); err == nil {
+		t.Error("expected an error for a line past the end")
+	}
+	if _, err := reporter.EndOfLineRange("other.go", 1); err == nil {
+		t.Error("expected an error for an unregistered file")
+	}
+
+	out, _ := reporter.FormatAs(FormatFehler, []*Diagnostic{NewDiagnostic(SeverityError, "expected ';'").WithRange(r)})
+	if !strings.Contains(out, "     1 | let x = 10\n"+strings.Repeat(" ", 9)+strings.Repeat(" ", 10)+"^\n") {
+		t.Errorf("expected the caret just past the line, got:\n%s", out)
+	}
+}
+
+func TestErrorHooksRunAfterRendering(t *testing.T) {
+	var buf bytes.Buffer
+	var atFirst, atEach []string
+	reporter := NewErrorReporter().WithNoColor(true).WithWriter(&buf).
+		WithOnFirstError(func(d *Diagnostic) { atFirst = append(atFirst, buf.String()) }).
+		WithOnError(func(d *Diagnostic) { atEach = append(atEach, buf.String()) })
+
+	reporter.Report(NewDiagnostic(SeverityError, "first failure"))
+	reporter.Report(NewDiagnostic(SeverityError, "second failure"))
+
+	if len(atFirst) != 1 || !strings.Contains(atFirst[0], "error: first failure") {
+		t.Errorf("expected OnFirstError to see the rendered error, got %q", atFirst)
+	}
+	if len(atEach) != 2 || !strings.Contains(atEach[1], "error: second failure") {
+		t.Errorf("expected OnError to see each rendered error, got %q", atEach)
+	}
+}
@@ -0,0 +1,63 @@
+package fehler
+
+import (
+	"strings"
+	"unicode"
+)
+
+var goKeywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true, "for": true,
+	"func": true, "go": true, "goto": true, "if": true, "import": true,
+	"interface": true, "map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true, "var": true,
+}
+
+// Returns the keyword set for a source language, or nil if it is not supported.
+func keywordsFor(language string) map[string]bool {
+	switch language {
+	case "go":
+		return goKeywords
+	default:
+		return nil
+	}
+}
+
+// Wraps every keyword in line with the given ANSI codes.
+// This is a best-effort highlight based on identifier boundaries, not a lexer,
+// so keywords inside strings and comments are highlighted too.
+func highlightKeywords(line string, keywords map[string]bool, start, end string) string {
+	isIdent := func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+
+	var sb strings.Builder
+	word := -1
+	flush := func(i int) {
+		if word < 0 {
+			return
+		}
+		if keywords[line[word:i]] {
+			sb.WriteString(start)
+			sb.WriteString(line[word:i])
+			sb.WriteString(end)
+		} else {
+			sb.WriteString(line[word:i])
+		}
+		word = -1
+	}
+
+	for i, r := range line {
+		if isIdent(r) {
+			if word < 0 {
+				word = i
+			}
+			continue
+		}
+		flush(i)
+		sb.WriteRune(r)
+	}
+	flush(len(line))
+
+	return sb.String()
+}
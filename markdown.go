@@ -0,0 +1,74 @@
+package fehler
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Fence language hints by file extension, for the Markdown code block.
+var markdownLanguages = map[string]string{
+	".go":   "go",
+	".zig":  "zig",
+	".rs":   "rust",
+	".c":    "c",
+	".h":    "c",
+	".py":   "python",
+	".js":   "javascript",
+	".ts":   "typescript",
+	".json": "json",
+	".yaml": "yaml",
+	".yml":  "yaml",
+}
+
+// Renders the diagnostic as GitHub-flavored Markdown, e.g. for a pull request comment.
+// The output is a bold severity header with the message, the location, a fenced
+// code block with the range's lines and two lines of context from source, and
+// the help and documentation URL as a blockquote. No ANSI codes are emitted.
+func RenderMarkdown(d *Diagnostic, source string) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "**%s**", d.Severity.Label())
+	if d.Code != nil {
+		fmt.Fprintf(&sb, " `%s`", *d.Code)
+	}
+	fmt.Fprintf(&sb, ": %s\n", d.ResolvedMessage())
+
+	if d.Range != nil {
+		sr := d.Range.Normalize()
+		fmt.Fprintf(&sb, "\nIn `%s`", sr.File)
+		if sr.HasPosition() {
+			fmt.Fprintf(&sb, " at line %d, column %d", sr.Start.Line, sr.Start.Column)
+		}
+		sb.WriteString(":\n")
+
+		if sr.HasPosition() && source != "" {
+			lines := strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+			first := max(sr.Start.Line-2, 1)
+			last := min(sr.End.Line+2, len(lines))
+			if first <= last {
+				fmt.Fprintf(&sb, "\n```%s\n", markdownLanguages[path.Ext(sr.File)])
+				for _, line := range lines[first-1 : last] {
+					sb.WriteString(line)
+					sb.WriteByte('\n')
+				}
+				sb.WriteString("```\n")
+			}
+		}
+	}
+
+	var quote []string
+	if d.Help != nil {
+		quote = append(quote, "**help:** "+*d.Help)
+	}
+	if d.Url != nil {
+		quote = append(quote, "**see:** "+*d.Url)
+	}
+	if len(quote) > 0 {
+		sb.WriteString("\n> ")
+		sb.WriteString(strings.Join(quote, "\n>\n> "))
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
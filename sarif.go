@@ -2,6 +2,7 @@ package fehler
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 )
 
@@ -39,11 +40,34 @@ type SarifConfiguration struct {
 }
 
 type SarifResult struct {
-	Message   SarifMessage    `json:"message"`
-	Level     string          `json:"level"`
-	RuleID    *string         `json:"ruleId,omitempty"`
-	Locations []SarifLocation `json:"locations,omitempty"`
-	Kind      string          `json:"kind,omitempty"`
+	Message          SarifMessage       `json:"message"`
+	Level            string             `json:"level"`
+	RuleID           *string            `json:"ruleId,omitempty"`
+	Locations        []SarifLocation    `json:"locations,omitempty"`
+	Kind             string             `json:"kind,omitempty"`
+	Suppressions     []SarifSuppression `json:"suppressions,omitempty"`
+	CodeFlows        []SarifCodeFlow    `json:"codeFlows,omitempty"`
+	RelatedLocations []SarifLocation    `json:"relatedLocations,omitempty"`
+	// Property bag. Results emitted by fehler carry the original severity label
+	// as "fehlerSeverity", which the SARIF level cannot fully represent.
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+type SarifCodeFlow struct {
+	ThreadFlows []SarifThreadFlow `json:"threadFlows"`
+}
+
+type SarifThreadFlow struct {
+	Locations []SarifThreadFlowLocation `json:"locations"`
+}
+
+type SarifThreadFlowLocation struct {
+	Location SarifLocation `json:"location"`
+}
+
+type SarifSuppression struct {
+	Kind  string `json:"kind"`
+	State string `json:"state,omitempty"`
 }
 
 type SarifMessage struct {
@@ -52,6 +76,7 @@ type SarifMessage struct {
 
 type SarifLocation struct {
 	PhysicalLocation SarifPhysicalLocation `json:"physicalLocation"`
+	Message          *SarifMessage         `json:"message,omitempty"`
 }
 
 type SarifPhysicalLocation struct {
@@ -78,16 +103,157 @@ func sarifLevel(sev Severity) string {
 		return "warning"
 	case SeverityNote:
 		return "note"
-	case SeverityTodo, SeverityUnimplemented:
+	case SeverityTodo, SeverityUnimplemented, SeveritySuccess:
 		return "none"
 	default:
 		return "none"
 	}
 }
 
+// Maps a severity to a SARIF result kind: "pass" for SeveritySuccess, "fail" otherwise.
+func sarifKind(sev Severity) string {
+	if sev == SeveritySuccess {
+		return "pass"
+	}
+	return "fail"
+}
+
+// Decodes a SARIF 2.1.0 document into a report.
+// Fields the report structs do not model are ignored.
+func ParseSarif(r io.Reader) (SarifReport, error) {
+	var report SarifReport
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return SarifReport{}, fmt.Errorf("fehler: parse sarif: %w", err)
+	}
+	return report, nil
+}
+
+func sarifLocation(r SourceRange) SarifLocation {
+	r = r.Normalize()
+	return SarifLocation{
+		PhysicalLocation: SarifPhysicalLocation{
+			ArtifactLocation: SarifArtifactLocation{
+				URI: r.File,
+			},
+			Region: SarifRegion{
+				StartLine:   r.Start.Line,
+				StartColumn: r.Start.Column,
+				EndLine:     r.End.Line,
+				EndColumn:   r.End.Column,
+			},
+		},
+	}
+}
+
+// Maps a SARIF result level back to a severity.
+// "none" becomes a note, and unknown or empty levels fall back to SARIF's default of warning.
+func SeverityFromSarifLevel(level string) Severity {
+	switch level {
+	case "error":
+		return SeverityError
+	case "warning":
+		return SeverityWarning
+	case "note", "none":
+		return SeverityNote
+	default:
+		return SeverityWarning
+	}
+}
+
+// Returns the severity whose Label is label.
+func severityFromLabel(label string) (Severity, bool) {
+	for sev := SeverityFatal; sev <= SeveritySuccess; sev++ {
+		if sev.Label() == label {
+			return sev, true
+		}
+	}
+	return 0, false
+}
+
+// Reconstructs diagnostics from the results of a SARIF report.
+// The message, rule ID (as code), rule help URI, suppression, and first location are restored.
+// The severity comes from the "fehlerSeverity" property when present, otherwise from the
+// level, or is SeveritySuccess for results of kind "pass".
+func DiagnosticsFromSarif(r SarifReport) []*Diagnostic {
+	var diagnostics []*Diagnostic
+	for _, run := range r.Runs {
+		helpURIs := make(map[string]string)
+		for _, rule := range run.Tool.Driver.Rules {
+			if rule.HelpURI != "" {
+				helpURIs[rule.ID] = rule.HelpURI
+			}
+		}
+
+		for _, res := range run.Results {
+			severity := SeverityFromSarifLevel(res.Level)
+			if res.Kind == "pass" {
+				severity = SeveritySuccess
+			}
+			if label, ok := res.Properties["fehlerSeverity"].(string); ok {
+				if sev, ok := severityFromLabel(label); ok {
+					severity = sev
+				}
+			}
+			d := NewDiagnostic(severity, res.Message.Text)
+			if res.RuleID != nil {
+				d.WithCode(*res.RuleID)
+				if uri, ok := helpURIs[*res.RuleID]; ok {
+					d.WithUrl(uri)
+				}
+			}
+			if len(res.Locations) > 0 {
+				loc := res.Locations[0].PhysicalLocation
+				region := loc.Region
+				endLine, endColumn := region.EndLine, region.EndColumn
+				if endLine == 0 {
+					endLine = region.StartLine
+				}
+				if endColumn == 0 {
+					endColumn = region.StartColumn
+				}
+				d.WithRange(NewSourceRangeSpan(loc.ArtifactLocation.URI, region.StartLine, region.StartColumn, endLine, endColumn))
+			}
+			if len(res.Suppressions) > 0 {
+				d.Suppress()
+			}
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return diagnostics
+}
+
+// Options for EmitSarifWithOptions. The zero value matches EmitSarif.
+type SarifOptions struct {
+	// Maps a severity to a SARIF level. Nil uses the default mapping, where
+	// Todo and Unimplemented become "none".
+	SarifLevelFor func(Severity) string
+}
+
+func (o SarifOptions) level(sev Severity) string {
+	if o.SarifLevelFor != nil {
+		return o.SarifLevelFor(sev)
+	}
+	return sarifLevel(sev)
+}
+
 // Emits all diagnostics in SARIF format to the given writer.
 // Supports version 2.1.0. Includes rule metadata if code is set.
 func EmitSarif(diagnostics []*Diagnostic, w io.Writer) error {
+	return encodeSarif(BuildSarifReport(diagnostics), w)
+}
+
+// Emits all diagnostics in SARIF format like EmitSarif, using the given options.
+func EmitSarifWithOptions(diagnostics []*Diagnostic, w io.Writer, opts SarifOptions) error {
+	return encodeSarif(buildSarifReport(diagnostics, opts), w)
+}
+
+// Builds the SARIF report that EmitSarif would write, without encoding it,
+// so callers can add extensions or adjust the tool metadata first.
+func BuildSarifReport(diagnostics []*Diagnostic) *SarifReport {
+	return buildSarifReport(diagnostics, SarifOptions{})
+}
+
+func buildSarifReport(diagnostics []*Diagnostic, opts SarifOptions) *SarifReport {
 	const sarifVersion = "2.1.0"
 	const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
 
@@ -99,10 +265,10 @@ func EmitSarif(diagnostics []*Diagnostic, w io.Writer) error {
 				ruleMap[code] = SarifRule{
 					ID: code,
 					ShortDescription: SarifMessage{
-						Text: d.Message,
+						Text: d.ResolvedMessage(),
 					},
 					DefaultConfiguration: &SarifConfiguration{
-						Level: sarifLevel(d.Severity),
+						Level: opts.level(d.Severity),
 					},
 					HelpURI: func() string {
 						if d.Url != nil {
@@ -124,34 +290,39 @@ func EmitSarif(diagnostics []*Diagnostic, w io.Writer) error {
 	for _, d := range diagnostics {
 		res := SarifResult{
 			Message: SarifMessage{
-				Text: d.Message,
+				Text: d.ResolvedMessage(),
 			},
-			Level: sarifLevel(d.Severity),
-			Kind:  "fail",
+			Level:      opts.level(d.Severity),
+			Kind:       sarifKind(d.Severity),
+			Properties: map[string]any{"fehlerSeverity": d.Severity.Label()},
 		}
 		if d.Code != nil {
 			res.RuleID = d.Code
 		}
+		if d.Suppressed {
+			res.Suppressions = []SarifSuppression{{Kind: "inSource", State: "accepted"}}
+		}
 		if d.Range != nil {
-			loc := SarifLocation{
-				PhysicalLocation: SarifPhysicalLocation{
-					ArtifactLocation: SarifArtifactLocation{
-						URI: d.Range.File,
-					},
-					Region: SarifRegion{
-						StartLine:   d.Range.Start.Line,
-						StartColumn: d.Range.Start.Column,
-						EndLine:     d.Range.End.Line,
-						EndColumn:   d.Range.End.Column,
-					},
-				},
+			res.Locations = []SarifLocation{sarifLocation(*d.Range)}
+		}
+		for _, rel := range d.Related {
+			loc := sarifLocation(rel.Range)
+			loc.Message = &SarifMessage{Text: rel.Message}
+			res.RelatedLocations = append(res.RelatedLocations, loc)
+		}
+		if len(d.CodeFlow) > 0 {
+			steps := make([]SarifThreadFlowLocation, 0, len(d.CodeFlow))
+			for _, step := range d.CodeFlow {
+				steps = append(steps, SarifThreadFlowLocation{Location: sarifLocation(step)})
 			}
-			res.Locations = []SarifLocation{loc}
+			res.CodeFlows = []SarifCodeFlow{{
+				ThreadFlows: []SarifThreadFlow{{Locations: steps}},
+			}}
 		}
 		results = append(results, res)
 	}
 
-	report := SarifReport{
+	return &SarifReport{
 		Version: sarifVersion,
 		Schema:  sarifSchema,
 		Runs: []SarifRun{{
@@ -166,7 +337,9 @@ func EmitSarif(diagnostics []*Diagnostic, w io.Writer) error {
 			Results: results,
 		}},
 	}
+}
 
+func encodeSarif(report *SarifReport, w io.Writer) error {
 	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
 
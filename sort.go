@@ -0,0 +1,47 @@
+package fehler
+
+import (
+	"cmp"
+	"strings"
+)
+
+// Compares diagnostics by file, then line, then column of their range.
+// Diagnostics without a range sort last. The result follows cmp.Compare,
+// so the function can be passed directly to slices.SortFunc.
+func ByLocation(a, b *Diagnostic) int {
+	if a.Range == nil || b.Range == nil {
+		return nilLast(a.Range == nil, b.Range == nil)
+	}
+	ra, rb := a.Range.Normalize(), b.Range.Normalize()
+	if c := strings.Compare(ra.File, rb.File); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(ra.Start.Line, rb.Start.Line); c != 0 {
+		return c
+	}
+	return cmp.Compare(ra.Start.Column, rb.Start.Column)
+}
+
+// Compares diagnostics by their code. Diagnostics without a code sort last.
+func ByCode(a, b *Diagnostic) int {
+	if a.Code == nil || b.Code == nil {
+		return nilLast(a.Code == nil, b.Code == nil)
+	}
+	return strings.Compare(*a.Code, *b.Code)
+}
+
+// Compares diagnostics by their resolved message.
+func ByMessage(a, b *Diagnostic) int {
+	return strings.Compare(a.ResolvedMessage(), b.ResolvedMessage())
+}
+
+func nilLast(aNil, bNil bool) int {
+	switch {
+	case aNil && bNil:
+		return 0
+	case aNil:
+		return 1
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,225 @@
+package fehler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Snapshot of a reporter written by ExportState and read by ImportState.
+type reporterState struct {
+	Diagnostics  []*Diagnostic     `json:"diagnostics"`
+	SourceHashes map[string]string `json:"sourceHashes"`
+	Counts       map[Severity]int  `json:"counts"`
+	Suppressed   int               `json:"suppressed"`
+	SawError     bool              `json:"sawError"`
+	SeenKeys     []string          `json:"seenKeys,omitempty"`
+	Config       reporterConfig    `json:"config"`
+}
+
+// Serializable configuration fields of a reporter.
+type reporterConfig struct {
+	Format               OutputFormat        `json:"format"`
+	NoColor              bool                `json:"noColor"`
+	TermWidth            int                 `json:"termWidth"`
+	StopOnFatal          bool                `json:"stopOnFatal"`
+	DisabledSeverities   map[Severity]bool   `json:"disabledSeverities,omitempty"`
+	MinSeverity          *Severity           `json:"minSeverity,omitempty"`
+	ShowHiddenCount      bool                `json:"showHiddenCount"`
+	ShowEllipsis         bool                `json:"showEllipsis"`
+	ShowSuppressed       bool                `json:"showSuppressed"`
+	Languages            map[string]string   `json:"languages,omitempty"`
+	SyntaxHighlighting   bool                `json:"syntaxHighlighting"`
+	WrapWidth            int                 `json:"wrapWidth"`
+	SummaryEvery         int                 `json:"summaryEvery"`
+	IndentPrefix         string              `json:"indentPrefix"`
+	CodeSeverities       map[string]Severity `json:"codeSeverities,omitempty"`
+	CollapseRepeats      bool                `json:"collapseRepeats"`
+	TabWidth             int                 `json:"tabWidth"`
+	AlignLabels          bool                `json:"alignLabels"`
+	ZeroBasedLines       bool                `json:"zeroBasedLines"`
+	MaxLineWidth         int                 `json:"maxLineWidth"`
+	TruncationIndicator  string              `json:"truncationIndicator"`
+	ShowTruncationColumn bool                `json:"showTruncationColumn"`
+	DocURLTemplate       string              `json:"docUrlTemplate"`
+	MaxGroupSize         int                 `json:"maxGroupSize"`
+	MaxSnippetLines      int                 `json:"maxSnippetLines"`
+	MessagePrefix        string              `json:"messagePrefix"`
+	UnderlineColor       string              `json:"underlineColor"`
+	GutterChar           string              `json:"gutterChar"`
+	HelpPosition         HelpPosition        `json:"helpPosition"`
+	ShowGhostText        bool                `json:"showGhostText"`
+	ShowSuggestionDiff   bool                `json:"showSuggestionDiff"`
+	ShowOffset           bool                `json:"showOffset"`
+	UseIcons             bool                `json:"useIcons"`
+	IconStyle            IconStyle           `json:"iconStyle"`
+	DedupeHelp           bool                `json:"dedupeHelp"`
+	ShowRangeInLocation  bool                `json:"showRangeInLocation"`
+}
+
+// Returns the hex-encoded SHA-256 hash of a source's content, as stored by ExportState.
+func SourceHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Encodes the collected diagnostics, counters, DedupKey keys seen so far,
+// configuration, and a hash of each registered source as JSON. Source content itself is not included;
+// after ImportState, compare CachedSourceHash with SourceHash of the current
+// content to decide whether a source can be re-registered.
+func (e *ErrorReporter) ExportState() ([]byte, error) {
+	e.mu.Lock()
+	state := reporterState{
+		Diagnostics:  make([]*Diagnostic, 0, len(e.collected)),
+		SourceHashes: make(map[string]string, len(e.Sources)),
+		Counts:       maps.Clone(e.counts),
+		Suppressed:   e.suppressed,
+		SawError:     e.sawError,
+		SeenKeys:     slices.Sorted(maps.Keys(e.seenKeys)),
+		Config:       e.config(),
+	}
+	for _, d := range e.collected {
+		state.Diagnostics = append(state.Diagnostics, resolvedCopy(d))
+	}
+	e.mu.Unlock()
+
+	for name, content := range e.Sources {
+		state.SourceHashes[name] = SourceHash(content)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("fehler: export state: %w", err)
+	}
+	return data, nil
+}
+
+// Restores collected diagnostics, counters, configuration, and source hashes
+// from data produced by ExportState, along with the DedupKey keys already seen
+// and whether OnFirstError has fired. Registered sources and the writer are
+// left untouched.
+func (e *ErrorReporter) ImportState(data []byte) error {
+	var state reporterState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("fehler: import state: %w", err)
+	}
+
+	e.applyConfig(state.Config)
+	e.sourceHashes = state.SourceHashes
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.collected = state.Diagnostics
+	e.counts = state.Counts
+	e.suppressed = state.Suppressed
+	e.sawError = state.SawError
+	e.seenKeys = make(map[string]bool, len(state.SeenKeys))
+	for _, key := range state.SeenKeys {
+		e.seenKeys[key] = true
+	}
+	return nil
+}
+
+// Returns the hash recorded for a source by the last ImportState, if any.
+func (e *ErrorReporter) CachedSourceHash(name string) (string, bool) {
+	hash, ok := e.sourceHashes[name]
+	return hash, ok
+}
+
+func (e *ErrorReporter) config() reporterConfig {
+	return reporterConfig{
+		Format:               e.Format,
+		NoColor:              e.NoColor,
+		TermWidth:            e.TermWidth,
+		StopOnFatal:          e.StopOnFatal,
+		DisabledSeverities:   e.DisabledSeverities,
+		MinSeverity:          e.MinSeverity,
+		ShowHiddenCount:      e.ShowHiddenCount,
+		ShowEllipsis:         e.ShowEllipsis,
+		ShowSuppressed:       e.ShowSuppressed,
+		Languages:            e.Languages,
+		SyntaxHighlighting:   e.SyntaxHighlighting,
+		WrapWidth:            e.WrapWidth,
+		SummaryEvery:         e.SummaryEvery,
+		IndentPrefix:         e.IndentPrefix,
+		CodeSeverities:       e.CodeSeverities,
+		CollapseRepeats:      e.CollapseRepeats,
+		TabWidth:             e.TabWidth,
+		AlignLabels:          e.AlignLabels,
+		ZeroBasedLines:       e.ZeroBasedLines,
+		MaxLineWidth:         e.MaxLineWidth,
+		TruncationIndicator:  e.TruncationIndicator,
+		ShowTruncationColumn: e.ShowTruncationColumn,
+		DocURLTemplate:       e.DocURLTemplate,
+		MaxGroupSize:         e.MaxGroupSize,
+		MaxSnippetLines:      e.MaxSnippetLines,
+		MessagePrefix:        e.MessagePrefix,
+		UnderlineColor:       e.UnderlineColor,
+		GutterChar:           e.GutterChar,
+		HelpPosition:         e.HelpPosition,
+		ShowGhostText:        e.ShowGhostText,
+		ShowSuggestionDiff:   e.ShowSuggestionDiff,
+		ShowOffset:           e.ShowOffset,
+		UseIcons:             e.UseIcons,
+		IconStyle:            e.IconStyle,
+		DedupeHelp:           e.DedupeHelp,
+		ShowRangeInLocation:  e.ShowRangeInLocation,
+	}
+}
+
+func (e *ErrorReporter) applyConfig(c reporterConfig) {
+	e.Format = c.Format
+	e.NoColor = c.NoColor
+	e.TermWidth = c.TermWidth
+	e.StopOnFatal = c.StopOnFatal
+	e.DisabledSeverities = c.DisabledSeverities
+	e.MinSeverity = c.MinSeverity
+	e.ShowHiddenCount = c.ShowHiddenCount
+	e.ShowEllipsis = c.ShowEllipsis
+	e.ShowSuppressed = c.ShowSuppressed
+	e.Languages = c.Languages
+	e.SyntaxHighlighting = c.SyntaxHighlighting
+	e.WrapWidth = c.WrapWidth
+	e.SummaryEvery = c.SummaryEvery
+	e.IndentPrefix = c.IndentPrefix
+	e.CodeSeverities = c.CodeSeverities
+	e.CollapseRepeats = c.CollapseRepeats
+	e.TabWidth = c.TabWidth
+	e.AlignLabels = c.AlignLabels
+	e.ZeroBasedLines = c.ZeroBasedLines
+	e.MaxLineWidth = c.MaxLineWidth
+	e.TruncationIndicator = c.TruncationIndicator
+	e.ShowTruncationColumn = c.ShowTruncationColumn
+	e.DocURLTemplate = c.DocURLTemplate
+	e.MaxGroupSize = c.MaxGroupSize
+	e.MaxSnippetLines = c.MaxSnippetLines
+	e.MessagePrefix = c.MessagePrefix
+	e.UnderlineColor = c.UnderlineColor
+	e.GutterChar = c.GutterChar
+	e.HelpPosition = c.HelpPosition
+	e.ShowGhostText = c.ShowGhostText
+	e.ShowSuggestionDiff = c.ShowSuggestionDiff
+	e.ShowOffset = c.ShowOffset
+	e.UseIcons = c.UseIcons
+	e.IconStyle = c.IconStyle
+	e.DedupeHelp = c.DedupeHelp
+	e.ShowRangeInLocation = c.ShowRangeInLocation
+}
+
+// Returns a shallow copy of d whose message, and those of its notes, have
+// their format arguments applied, since the arguments are not serialized.
+func resolvedCopy(d *Diagnostic) *Diagnostic {
+	c := *d
+	c.Message = d.ResolvedMessage()
+	c.messageArgs = nil
+	if len(d.Notes) > 0 {
+		c.Notes = make([]*Diagnostic, len(d.Notes))
+		for i, note := range d.Notes {
+			c.Notes[i] = resolvedCopy(note)
+		}
+	}
+	return &c
+}
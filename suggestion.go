@@ -0,0 +1,110 @@
+package fehler
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// A proposed replacement for the text covered by a range.
+// The range is inclusive, like every SourceRange.
+type Suggestion struct {
+	Range       SourceRange
+	Replacement string
+
+	// Text covered by Range when the suggestion was made, if known.
+	Before string
+}
+
+// A suggestion resolved to byte offsets in its source.
+type edit struct {
+	start, end  int
+	replacement string
+}
+
+// Returns a copy of this diagnostic with a suggestion whose Before text is read
+// from the reporter's source for r. Returns an error if the source is not
+// registered or r lies outside it.
+func (d *Diagnostic) WithSuggestionFromRange(e *ErrorReporter, r SourceRange, replacement string) (*Diagnostic, error) {
+	before, err := e.SourceText(r)
+	if err != nil {
+		return d, err
+	}
+	d.Suggestions = append(d.Suggestions, Suggestion{Range: r, Replacement: replacement, Before: before})
+	return d, nil
+}
+
+// Returns the registered source text covered by the inclusive range r.
+// Returns an error if the file is not registered or r lies outside it.
+func (e *ErrorReporter) SourceText(r SourceRange) (string, error) {
+	source, ok := e.Sources[r.File]
+	if !ok {
+		return "", fmt.Errorf("fehler: no source registered for %q", r.File)
+	}
+	ed, err := resolveEdit(source, Suggestion{Range: r})
+	if err != nil {
+		return "", err
+	}
+	return source[ed.start:ed.end], nil
+}
+
+// Applies the suggestions of all diagnostics to the given sources.
+// Returns the updated sources, leaving the input map untouched, and the number of
+// fixes applied. Suggestions that overlap an earlier one in the same file are
+// skipped. Returns an error if a suggestion refers to a file that is not in
+// sources or to a position outside it.
+func ApplySuggestions(sources map[string]string, ds []*Diagnostic) (map[string]string, int, error) {
+	edits := make(map[string][]edit)
+	for _, d := range ds {
+		for _, s := range d.Suggestions {
+			source, ok := sources[s.Range.File]
+			if !ok {
+				return nil, 0, fmt.Errorf("fehler: no source registered for %q", s.Range.File)
+			}
+			e, err := resolveEdit(source, s)
+			if err != nil {
+				return nil, 0, err
+			}
+			edits[s.Range.File] = append(edits[s.Range.File], e)
+		}
+	}
+
+	updated := maps.Clone(sources)
+	applied := 0
+	for file, fileEdits := range edits {
+		slices.SortStableFunc(fileEdits, func(a, b edit) int {
+			return a.start - b.start
+		})
+
+		kept := fileEdits[:0]
+		for _, e := range fileEdits {
+			if len(kept) > 0 && e.start < kept[len(kept)-1].end {
+				continue
+			}
+			kept = append(kept, e)
+		}
+
+		source := updated[file]
+		for i := len(kept) - 1; i >= 0; i-- {
+			e := kept[i]
+			source = source[:e.start] + e.replacement + source[e.end:]
+		}
+		updated[file] = source
+		applied += len(kept)
+	}
+
+	return updated, applied, nil
+}
+
+func resolveEdit(source string, s Suggestion) (edit, error) {
+	r := s.Range.Normalize()
+	start, ok := offsetOf(source, r.Start)
+	if !ok {
+		return edit{}, fmt.Errorf("fehler: suggestion start %s is outside the source", r)
+	}
+	end, ok := offsetOf(source, Position{Line: r.End.Line, Column: r.End.Column + 1})
+	if !ok {
+		return edit{}, fmt.Errorf("fehler: suggestion end %s is outside the source", r)
+	}
+	return edit{start: start, end: end, replacement: s.Replacement}, nil
+}
@@ -0,0 +1,55 @@
+package fehler
+
+import "fmt"
+
+// Describes the diagnostics of one code, for tools that define many codes up front.
+type DiagnosticTemplate struct {
+	Code     string
+	Message  string
+	Severity Severity
+
+	// Format of the help text, given the same arguments as Message. Use explicit
+	// argument indexes, e.g. "%[2]s", to pick only some of them. Empty means no help.
+	HelpFmt string
+
+	// Documentation URL. Empty means none.
+	URL string
+}
+
+// Creates a diagnostic from the template, formatting Message and HelpFmt with args
+// as by fmt.Sprintf.
+func (t DiagnosticTemplate) New(args ...any) *Diagnostic {
+	d := NewDiagnostic(t.Severity, fmt.Sprintf(t.Message, args...)).WithCode(t.Code)
+	if t.HelpFmt != "" {
+		d.WithHelp(fmt.Sprintf(t.HelpFmt, args...))
+	}
+	if t.URL != "" {
+		d.WithUrl(t.URL)
+	}
+	return d
+}
+
+// Diagnostic templates keyed by code. Create one with make before registering.
+type TemplateCatalog map[string]DiagnosticTemplate
+
+// Adds a template to the catalog. Returns an error if the catalog is nil,
+// the template has no code, or its code is already registered.
+func (c TemplateCatalog) Register(t DiagnosticTemplate) error {
+	if c == nil {
+		return fmt.Errorf("fehler: register template %q in a nil catalog", t.Code)
+	}
+	if t.Code == "" {
+		return fmt.Errorf("fehler: template has no code")
+	}
+	if _, ok := c[t.Code]; ok {
+		return fmt.Errorf("fehler: template %q is already registered", t.Code)
+	}
+	c[t.Code] = t
+	return nil
+}
+
+// Returns the template registered for code, if any.
+func (c TemplateCatalog) Lookup(code string) (DiagnosticTemplate, bool) {
+	t, ok := c[code]
+	return t, ok
+}